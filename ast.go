@@ -0,0 +1,199 @@
+package mustache
+
+import "strings"
+
+// Pos is the position of a node in a template.
+type Pos struct {
+	Line   int // line, starting at 1
+	Column int // column in characters, starting at 1
+}
+
+// Position returns the position.
+func (p Pos) Position() Pos {
+	return p
+}
+
+// Node is an element of a compiled template. The types of node are
+// *Text, *Variable, *Section, *InvertedSection, *Partial, *Parent, *Block, *Comment and *SetDelimiter.
+type Node interface {
+	Position() Pos
+	node()
+}
+
+// Text is text that is written as is.
+type Text struct {
+	Pos
+	Text string
+}
+
+// Variable is an interpolation, i.e. - {{name}}, {{{name}}} or {{&name}}.
+type Variable struct {
+	Pos
+	Name    string
+	Tag     string   // the text of the tag, as written in the template
+	Escaped bool     // false for triple mustaches and {{&name}}
+	Filters []string // the filters applied to the value, when filters are enabled
+}
+
+// Section is rendered if the name is truthy, once for each item if it is a list, i.e. - {{#name}}...{{/name}}.
+type Section struct {
+	Pos
+	Name  string
+	Tag   string // the text of the opening tag, as written in the template
+	Text  string // the raw text within the section
+	Nodes []Node
+}
+
+// InvertedSection is rendered if the name is falsey, i.e. - {{^name}}...{{/name}}.
+type InvertedSection struct {
+	Pos
+	Name  string
+	Tag   string // the text of the opening tag, as written in the template
+	Nodes []Node
+}
+
+// Partial includes another template, i.e. - {{> name}}.
+// A partial on a line of its own is indented by the whitespace before it, which is added to each line of the partial.
+// A dynamic partial, i.e. - {{>*name}}, includes the partial named by the value of name.
+type Partial struct {
+	Pos
+	Name    string
+	Indent  string
+	Dynamic bool
+}
+
+// Parent includes another template, overriding its blocks, i.e. - {{<name}}...{{/name}}.
+// A parent on a line of its own is indented as a partial is.
+type Parent struct {
+	Pos
+	Name   string
+	Indent string
+	Nodes  []Node
+}
+
+// Block is content that can be overridden by a parent tag, i.e. - {{$name}}...{{/name}}.
+// The Indent of a block on a line of its own is the indentation of its content. The content of
+// an override is indented by the Indent of the block it overrides instead.
+type Block struct {
+	Pos
+	Name   string
+	Indent string
+	Nodes  []Node
+}
+
+// Comment is ignored when rendering, i.e. - {{! text}}.
+type Comment struct {
+	Pos
+	Text string
+}
+
+// SetDelimiter changes the delimiters for the rest of the template, i.e. - {{=<% %>=}}.
+type SetDelimiter struct {
+	Pos
+	Open  string
+	Close string
+}
+
+func (*Text) node()            {}
+func (*Variable) node()        {}
+func (*Section) node()         {}
+func (*InvertedSection) node() {}
+func (*Partial) node()         {}
+func (*Parent) node()          {}
+func (*Block) node()           {}
+func (*Comment) node()         {}
+func (*SetDelimiter) node()    {}
+
+// Nodes returns the syntax tree of the template. The nodes are built each time they are
+// requested, so changing them does not change the template.
+func (t *Template) Nodes() []Node {
+	return nodes(t.token.children)
+}
+
+// Nodes converts tokens into nodes. Closing tags and text that was removed
+// from standalone lines are left out.
+func nodes(tokens []*token) []Node {
+	var ns []Node
+	for _, t := range tokens {
+		pos := Pos{Line: t.line, Column: t.col}
+		if !t.within {
+			if t.args != "" {
+				ns = append(ns, &Text{Pos: pos, Text: t.args})
+			}
+			continue
+		}
+
+		switch t.cmd {
+		case "":
+			ns = append(ns, &Variable{Pos: pos, Name: t.args, Tag: t.tag, Escaped: !t.notEscaped, Filters: t.filters})
+		case "#":
+			ns = append(ns, &Section{Pos: pos, Name: t.args, Tag: t.tag, Text: t.text, Nodes: nodes(t.children)})
+		case "^":
+			ns = append(ns, &InvertedSection{Pos: pos, Name: t.args, Tag: t.tag, Nodes: nodes(t.children)})
+		case ">":
+			ns = append(ns, &Partial{Pos: pos, Name: t.args, Indent: t.indent, Dynamic: t.dynamic})
+		case "<":
+			ns = append(ns, &Parent{Pos: pos, Name: t.args, Indent: t.indent, Nodes: nodes(t.children)})
+		case "$":
+			ns = append(ns, &Block{Pos: pos, Name: t.args, Indent: t.indent, Nodes: nodes(t.children)})
+		case "!":
+			// the args of a comment have had their whitespace removed, so use the tag
+			text := strings.TrimSuffix(strings.TrimPrefix(t.tag, t.otag), t.ctag)
+			ns = append(ns, &Comment{Pos: pos, Text: strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(text), "!"))})
+		case "=":
+			o, c, _ := parseDelimiters(t.args)
+			ns = append(ns, &SetDelimiter{Pos: pos, Open: o, Close: c})
+		}
+	}
+
+	return ns
+}
+
+// Children returns the nodes within a node.
+func children(n Node) []Node {
+	switch n := n.(type) {
+	case *Section:
+		return n.Nodes
+	case *InvertedSection:
+		return n.Nodes
+	case *Parent:
+		return n.Nodes
+	case *Block:
+		return n.Nodes
+	}
+
+	return nil
+}
+
+// Visitor has its Visit method called for each node encountered by Walk.
+// If the visitor w returned is not nil, Walk visits each of the children of the node with w,
+// followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the nodes in depth first order, i.e. - Walk(v, template.Nodes()...)
+func Walk(v Visitor, nodes ...Node) {
+	for _, n := range nodes {
+		if w := v.Visit(n); w != nil {
+			Walk(w, children(n)...)
+			w.Visit(nil)
+		}
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+
+	return nil
+}
+
+// Inspect traverses the nodes in depth first order, calling f for each node.
+// If f returns true the children of the node are inspected, followed by a call of f(nil).
+func Inspect(f func(Node) bool, nodes ...Node) {
+	Walk(inspector(f), nodes...)
+}
@@ -0,0 +1,79 @@
+package mustache
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNodes(t *testing.T) {
+	src := "Hello {{name}}!\n{{! a comment }}\n{{#items}}\n  {{{.}}}{{> item}}\n{{/items}}\n{{^items}}none{{/items}}{{=<% %>=}}<%<layout%><%$title%>hi<%/title%><%/layout%>"
+	template, err := Compile(src)
+	if err != nil {
+		t.Fatalf("Unexpected error while compiling, %s", err)
+	}
+
+	expected := []Node{
+		&Text{Pos{1, 1}, "Hello "},
+		&Variable{Pos: Pos{1, 7}, Name: "name", Tag: "{{name}}", Escaped: true},
+		&Text{Pos{1, 15}, "!\n"},
+		&Comment{Pos{2, 1}, "a comment"},
+		&Section{Pos{3, 1}, "items", "{{#items}}", "\n  {{{.}}}{{> item}}\n", []Node{
+			&Text{Pos{4, 1}, "  "},
+			&Variable{Pos: Pos{4, 3}, Name: ".", Tag: "{{{.}}}", Escaped: false},
+			&Partial{Pos{4, 10}, "item", "", false},
+			&Text{Pos{4, 20}, "\n"},
+		}},
+		&InvertedSection{Pos{6, 1}, "items", "{{^items}}", []Node{
+			&Text{Pos{6, 11}, "none"},
+		}},
+		&SetDelimiter{Pos{6, 25}, "<%", "%>"},
+		&Parent{Pos{6, 36}, "layout", "", []Node{
+			&Block{Pos{6, 47}, "title", "", []Node{
+				&Text{Pos{6, 57}, "hi"},
+			}},
+		}},
+	}
+
+	if nodes := template.Nodes(); !reflect.DeepEqual(nodes, expected) {
+		for i, n := range nodes {
+			t.Logf("%d: %#v", i, n)
+		}
+		t.Errorf("Incorrect nodes")
+	}
+}
+
+type countingVisitor map[string]int
+
+func (v countingVisitor) Visit(n Node) Visitor {
+	if n == nil {
+		v["nil"]++
+	} else {
+		v[reflect.TypeOf(n).Elem().Name()]++
+	}
+	return v
+}
+
+func TestWalk(t *testing.T) {
+	template, _ := Compile("{{#a}}{{#b}}{{c}}{{/b}}{{d}}{{/a}}{{e}}")
+
+	v := countingVisitor{}
+	Walk(v, template.Nodes()...)
+	if v["Section"] != 2 || v["Variable"] != 3 || v["nil"] != 5 {
+		t.Errorf("Incorrect nodes visited, got %v", v)
+	}
+
+	var names []string
+	Inspect(func(n Node) bool {
+		switch n := n.(type) {
+		case *Section:
+			names = append(names, n.Name)
+			return n.Name != "b"
+		case *Variable:
+			names = append(names, n.Name)
+		}
+		return true
+	}, template.Nodes()...)
+	if !reflect.DeepEqual(names, []string{"a", "b", "d", "e"}) {
+		t.Errorf("Incorrect nodes inspected, got %v", names)
+	}
+}
@@ -0,0 +1,331 @@
+package mustache
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// IssueKind describes a problem found when checking a template against a type.
+type IssueKind int
+
+const (
+	UnresolvedName     IssueKind = iota + 1 // a name that can never be found in the context
+	NotIterable                             // a section over a value that can not be iterated or used as a context
+	UnreachableField                        // a name that matches a field that lookups can not reach, such as an unexported field
+	UnresolvedInverted                      // a name that can never be found, used by or within an inverted section, where it may be missing on purpose
+)
+
+// String returns a short description of the kind of issue.
+func (k IssueKind) String() string {
+	switch k {
+	case UnresolvedName:
+		return "unresolved name"
+	case NotIterable:
+		return "not iterable"
+	case UnreachableField:
+		return "unreachable field"
+	case UnresolvedInverted:
+		return "unresolved name in inverted section"
+	}
+
+	return fmt.Sprintf("IssueKind(%d)", int(k))
+}
+
+// Issue is a problem found by CheckAgainst.
+type Issue struct {
+	Name   string    // name of the template or partial, empty if it was not named
+	Key    string    // the name that has the problem
+	Line   int       // line of the tag, starting at 1
+	Column int       // column of the tag in characters, starting at 1
+	Tag    string    // the tag as written in the template
+	Kind   IssueKind // the kind of issue
+}
+
+// String returns the issue prefixed with its position, i.e. - email:3:7: unresolved name: ...
+func (i Issue) String() string {
+	return fmt.Sprintf("%s %s: %s can not be rendered for %s", position(i.Name, i.Line, i.Column), i.Kind, i.Key, i.Tag)
+}
+
+// CheckAgainst checks the names used by the template against the type of sample, as if it was
+// the data passed to Execute, and returns the problems found. Only the type of sample is used.
+//
+// The context stack is simulated with types, so a name is only reported if no value of the type
+// could ever provide it. Names such as @index are only found within sections that iterate and provide them. Anything looked up through an interface{} or a map with interface{}
+// values can hold anything, so the names within it are not checked.
+// Partials and parents are loaded and checked with the context stack they would be rendered with.
+// The names of dynamic partials are checked, but the partials they name are not.
+func CheckAgainst(tmpl *Template, sample interface{}) []Issue {
+	c := &checker{template: tmpl, name: tmpl.name, loading: make(map[string]bool)}
+	c.check(tmpl.token, []reflect.Type{reflect.TypeOf(sample)})
+
+	return c.issues
+}
+
+// Checker holds the state of a single check of a template.
+type checker struct {
+	template *Template
+	name     string          // name of the template or partial being checked
+	loading  map[string]bool // partials being checked, to stop recursive partials
+	names    iteration       // the @ names that the enclosing sections provide
+	inverted int             // how many inverted sections the current token is within
+	issues   []Issue
+}
+
+// Iteration describes the @ names that a section provides to its content by the way it goes over its value.
+type iteration int
+
+const (
+	iterates iteration = 1 << iota // each item is rendered in turn, with @index, @index1, @first and @last when metadata is enabled
+	counted                        // the number of items is known in advance, with @length when metadata is enabled
+	keyed                          // each item has a key, as @key
+)
+
+// Check walks the token as the renderer would, with the types of the context stack in place of the values.
+// A nil type is a context that could hold anything.
+func (c *checker) check(t *token, tstack []reflect.Type) {
+	if !t.within {
+		return
+	}
+
+	switch {
+	case t.cmd == "#":
+		typ, ok := c.resolve(t, tstack)
+		if !ok {
+			return
+		}
+		if isLambdaType(typ) {
+			c.checkChildren(t.children, tstack)
+			return
+		}
+		if item, it, ok := c.sectionType(typ); ok {
+			names := c.names
+			c.names |= it
+			c.checkChildren(t.children, append(tstack, item))
+			c.names = names
+		} else {
+			c.report(t, NotIterable)
+		}
+	case t.cmd == "^":
+		c.inverted++
+		c.resolve(t, tstack)
+		c.checkChildren(t.children, tstack)
+		c.inverted--
+	case t.cmd == ">" && t.dynamic:
+		c.resolve(t, tstack)
+	case t.cmd == ">":
+		c.checkPartial(t.args, tstack)
+	case t.cmd == "<":
+		c.checkChildren(t.children, tstack)
+		c.checkPartial(t.args, tstack)
+	case t.cmd == "$":
+		c.checkChildren(t.children, tstack)
+	case t.cmd == "" && t.args != "":
+		c.resolve(t, tstack)
+	case t.cmd == "":
+		c.checkChildren(t.children, tstack)
+	}
+}
+
+// CheckChildren checks each of the tokens in turn.
+func (c *checker) checkChildren(children []*token, tstack []reflect.Type) {
+	for _, child := range children {
+		c.check(child, tstack)
+	}
+}
+
+// CheckPartial loads the partial and checks it with the context stack of the tag including it.
+// Partials that do not exist or can not be loaded are left for the renderer to report.
+func (c *checker) checkPartial(name string, tstack []reflect.Type) {
+	if c.loading[name] {
+		return
+	}
+	p, err := c.template.partial(name, "")
+	if err != nil || p == nil {
+		return
+	}
+
+	parentName := c.name
+	c.name = name
+	c.loading[name] = true
+	c.check(p, tstack)
+	delete(c.loading, name)
+	c.name = parentName
+}
+
+// Report records an issue for the token.
+func (c *checker) report(t *token, kind IssueKind) {
+	c.issues = append(c.issues, Issue{Name: c.name, Key: t.args, Line: t.line, Column: t.col, Tag: t.tag, Kind: kind})
+}
+
+// Resolve finds the type of the args of the token in the context stack, as contextStackContains
+// would find the value, and reports the name if it can not be found.
+func (c *checker) resolve(t *token, tstack []reflect.Type) (reflect.Type, bool) {
+	if c.provided(t.args) {
+		return nil, true
+	}
+
+	typ, ok, unreachable := stackType(tstack, t.args)
+	switch {
+	case ok:
+		return typ, true
+	case unreachable:
+		c.report(t, UnreachableField)
+	case c.inverted > 0:
+		c.report(t, UnresolvedInverted)
+	default:
+		c.report(t, UnresolvedName)
+	}
+
+	return nil, false
+}
+
+// Provided returns a boolean indicating whether the name, or the first part of a dotted name,
+// is an @ name that an enclosing section provides while iterating.
+func (c *checker) provided(name string) bool {
+	name, _, _ = strings.Cut(name, ".")
+	switch name {
+	case "@key":
+		return c.names&keyed != 0
+	case "@index", "@index1", "@first", "@last":
+		return c.names&iterates != 0 && c.template.iterationMetadata
+	case "@length":
+		return c.names&counted != 0 && c.template.iterationMetadata
+	}
+
+	return false
+}
+
+// SectionType returns the type that a section over a value of type t pushes onto the context stack,
+// mirroring renderSection, and the @ names it provides, or false if a value of the type can not be
+// iterated or used as a context.
+func (c *checker) sectionType(t reflect.Type) (reflect.Type, iteration, bool) {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() == reflect.Interface {
+		// the value could be anything, including a map iterated over
+		return nil, iterates | counted | keyed, true
+	}
+
+	switch t.Kind() {
+	case reflect.Array, reflect.Slice:
+		return t.Elem(), iterates | counted, true
+	case reflect.Map:
+		if c.template.iterateMaps[t] {
+			return t.Elem(), iterates | counted | keyed, true
+		}
+	case reflect.Chan:
+		if c.template.iterateAll && t.ChanDir()&reflect.RecvDir != 0 {
+			return t.Elem(), iterates, true
+		}
+		return nil, 0, false
+	case reflect.Func:
+		switch {
+		case !c.template.iterateAll:
+		case t.CanSeq2():
+			return t.In(0).In(1), iterates | keyed, true
+		case t.CanSeq():
+			return t.In(0).In(0), iterates, true
+		}
+		return nil, 0, false
+	}
+
+	return t, 0, true
+}
+
+// StackType finds the type of a key in a context stack of types. It reports whether the key
+// can be found and whether a field was found that matches the key but can not be looked up.
+func stackType(tstack []reflect.Type, key string) (reflect.Type, bool, bool) {
+	unreachable := false
+	for i := len(tstack) - 1; i >= 0; i-- {
+		if key == "." {
+			return tstack[i], true, false
+		}
+
+		typ, ok, hidden := keyType(tstack[i], key)
+		if ok {
+			return typ, true, false
+		}
+		unreachable = unreachable || hidden
+	}
+
+	if strings.Contains(key, ".") {
+		searchstack := tstack
+		var typ reflect.Type
+		for _, prefix := range strings.Split(key, ".") {
+			var ok, hidden bool
+			if typ, ok, hidden = stackType(searchstack, prefix); !ok {
+				return nil, false, hidden
+			}
+			searchstack = []reflect.Type{typ}
+		}
+		return typ, true, false
+	}
+
+	return nil, false, unreachable
+}
+
+// KeyType finds the type of a single key, without any dots, in a context of type t, as lookupKey
+// would find the value. A nil type is returned for values that could be of any type.
+func keyType(t reflect.Type, key string) (reflect.Type, bool, bool) {
+	for t != nil && (t.Kind() == reflect.Ptr || t.Kind() == reflect.Interface) {
+		if typ, ok := methodType(t, key); ok {
+			return typ, true, false
+		}
+		if t.Kind() == reflect.Interface {
+			// the dynamic type could be anything
+			return nil, true, false
+		}
+		t = t.Elem()
+	}
+	if t == nil {
+		return nil, true, false
+	}
+
+	switch t.Kind() {
+	case reflect.Map:
+		if t.Key().Kind() == reflect.String {
+			return t.Elem(), true, false
+		}
+	case reflect.Struct:
+		if index, ok := structFields(t)[key]; ok {
+			return t.FieldByIndex(index).Type, true, false
+		}
+		if typ, ok := methodType(reflect.PointerTo(t), key); ok {
+			return typ, true, false
+		}
+		_, hidden := t.FieldByName(key)
+		return nil, false, hidden
+	}
+
+	typ, ok := methodType(t, key)
+	return typ, ok, false
+}
+
+// MethodType returns the type of the value returned by the method named key,
+// if it could be called by callMethod.
+func methodType(t reflect.Type, key string) (reflect.Type, bool) {
+	m, ok := t.MethodByName(key)
+	if !ok {
+		return nil, false
+	}
+
+	in := m.Type.NumIn()
+	if t.Kind() != reflect.Interface {
+		// the receiver
+		in--
+	}
+	mt := m.Type
+	if in != 0 || mt.NumOut() == 0 || mt.NumOut() > 2 || (mt.NumOut() == 2 && !mt.Out(1).Implements(errorType)) {
+		return nil, false
+	}
+
+	return mt.Out(0), true
+}
+
+// IsLambdaType returns a boolean indicating whether values of the type are section lambdas.
+func isLambdaType(t reflect.Type) bool {
+	return t == reflect.TypeOf(func(string) string { return "" }) ||
+		t == reflect.TypeOf(func(string, func(string) string) string { return "" })
+}
@@ -0,0 +1,101 @@
+package mustache
+
+import (
+	"reflect"
+	"testing"
+)
+
+type checkOrder struct {
+	User   lookupUser
+	Items  []lookupAddress
+	Totals map[string]int
+	Extra  interface{}
+	Events chan string
+}
+
+func TestCheckAgainst(t *testing.T) {
+	type expects struct {
+		template string
+		issues   []IssueKind
+	}
+
+	tests := []expects{
+		{"{{User.First}} {{User.surname}} {{User.FullName}} {{User.Initials}} {{User.id}}", nil},
+		{"{{#Items}}{{city}}{{User.first_name}}{{.}}{{/Items}}", nil},
+		{"{{Totals.anything}}{{Extra.anything.at.all}}{{#Extra}}{{whatever}}{{/Extra}}", nil},
+		{"{{#User}}{{First}}{{#Address}}{{city}}{{Last}}{{/Address}}{{/User}}", nil},
+		{"{{missing}}", []IssueKind{UnresolvedName}},
+		{"{{User.Email}}", []IssueKind{UnresolvedName}},
+		{"{{^Items}}{{nope}}{{/Items}}{{^gone}}{{/gone}}", []IssueKind{UnresolvedInverted, UnresolvedInverted}},
+		{"{{^User}}{{User.internal}}{{/User}}{{missing}}", []IssueKind{UnreachableField, UnresolvedName}},
+		{"{{#Items}}{{City}}{{/Items}}", nil},
+		{"{{#Items}}{{town}}{{/Items}}", []IssueKind{UnresolvedName}},
+		{"{{#nope}}{{ignored}}{{/nope}}", []IssueKind{UnresolvedName}},
+		{"{{User.internal}}{{User.Hidden}}{{User.Password}}", []IssueKind{UnreachableField, UnreachableField, UnreachableField}},
+		{"{{#Events}}{{.}}{{/Events}}", []IssueKind{NotIterable}},
+		{"{{#Items}}{{@index}}{{/Items}}", []IssueKind{UnresolvedName}},
+		{"{{>*User.First}}{{>*widget}}", []IssueKind{UnresolvedName}},
+	}
+
+	for _, test := range tests {
+		template, err := Compile(test.template)
+		if err != nil {
+			t.Fatalf("Unexpected error while compiling %s, %s", test.template, err)
+		}
+
+		var kinds []IssueKind
+		for _, issue := range CheckAgainst(template, &checkOrder{}) {
+			kinds = append(kinds, issue.Kind)
+		}
+		if !reflect.DeepEqual(kinds, test.issues) {
+			t.Errorf("%s expected %v, but got %v", test.template, test.issues, kinds)
+		}
+	}
+}
+
+func TestCheckAgainstOptions(t *testing.T) {
+	partials := MapLoader{"user": "{{First}} {{Email}}", "loop": "{{#User}}{{> loop}}{{/User}}"}
+	template, err := Compile("{{#Events}}{{@index}}{{.}}{{/Events}}{{#User}}{{> user}}{{/User}}{{> loop}}", Partials(partials), IterateAll(), IterationMetadata())
+	if err != nil {
+		t.Fatalf("Unexpected error while compiling, %s", err)
+	}
+
+	issues := CheckAgainst(template, checkOrder{})
+	if len(issues) != 1 {
+		t.Fatalf("Expected 1 issue, but got %v", issues)
+	}
+	expected := "user:1:11: unresolved name: Email can not be rendered for {{Email}}"
+	if s := issues[0].String(); s != expected {
+		t.Errorf("Expected %s, but got %s", expected, s)
+	}
+}
+
+func TestCheckAgainstIterationNames(t *testing.T) {
+	type expects struct {
+		template string
+		issues   []IssueKind
+	}
+
+	tests := []expects{
+		{"{{#Items}}{{@index}}{{@index1}}{{@first}}{{@last}}{{@length}}{{/Items}}", nil},
+		{"{{#Totals}}{{@key}}{{@length}}{{/Totals}}{{#Events}}{{@index}}{{/Events}}", nil},
+		{"{{#Items}}{{#city}}{{@index}}{{/city}}{{/Items}}{{#Extra}}{{@key}}{{/Extra}}", nil},
+		{"{{@index}}{{#User}}{{@first}}{{/User}}", []IssueKind{UnresolvedName, UnresolvedName}},
+		{"{{#Items}}{{@key}}{{/Items}}{{#Events}}{{@length}}{{/Events}}", []IssueKind{UnresolvedName, UnresolvedName}},
+	}
+
+	for _, test := range tests {
+		template, err := Compile(test.template, IterateAll(map[string]int(nil)), IterationMetadata())
+		if err != nil {
+			t.Fatalf("Unexpected error while compiling %s, %s", test.template, err)
+		}
+
+		var kinds []IssueKind
+		for _, issue := range CheckAgainst(template, &checkOrder{}) {
+			kinds = append(kinds, issue.Kind)
+		}
+		if !reflect.DeepEqual(kinds, test.issues) {
+			t.Errorf("%s expected %v, but got %v", test.template, test.issues, kinds)
+		}
+	}
+}
@@ -0,0 +1,832 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/format"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	mustache "github.com/smarden1/mustache.go"
+)
+
+// maxPartialDepth is how deeply partials may be nested while rendering, the same as the package.
+const maxPartialDepth = 100
+
+// Frame is a context on the context stack of the generated code.
+type frame struct {
+	expr    string // Go expression holding the context
+	typ     *goType
+	nilable bool // whether the context may be a nil pointer
+}
+
+// Value is a name that has been looked up by the generated code.
+type value struct {
+	expr, ok string // Go expressions holding the value and whether it was found
+	typ      *goType
+}
+
+// Step is the code that looks up a key in a single context.
+type step struct {
+	emit   func(v, ok string) // writes the code that sets v and ok if the key is found
+	typ    *goType            // type of the value found
+	always bool               // whether the key is always found
+}
+
+// Generator writes the Go code that renders a template with a value of a Go type.
+//
+// Names are looked up with the types of the contexts, so that fields are read and methods called directly.
+// Contexts of types that are only known at runtime are looked up with the helpers of the genrt package instead.
+// Partials are loaded when generating and written inline, other than those that include themselves,
+// which are written as functions that look up every name at runtime.
+type generator struct {
+	pkg      *pkg
+	loader   mustache.PartialLoader
+	funcName string
+	err      error // the first error found
+
+	buf       *bytes.Buffer
+	name      string // name of the template or partial being written, used in errors
+	vars      int    // count of variables declared, used to name them
+	depth     int    // how many partials deep the code being written is
+	depthBase string // the variable holding the depth of a partial function, empty in the render function
+
+	blocks   []map[string]*mustache.Block // block overrides of the enclosing parents, outermost first
+	inlining map[string]bool              // partials being written inline, to find partials that include themselves
+
+	templates map[partialKey][]mustache.Node  // compiled partials, nil if they do not exist
+	delims    map[*mustache.Section][2]string // the delimiters each section was written with
+	funcs     map[partialKey]string           // functions written for partials
+	queue     []partialKey                    // partials whose functions are yet to be written
+	leading   map[partialKey][]partialKey     // the partial functions that lead to each partial function
+	writing   []partialKey                    // the partial functions leading to the code being written
+	imports   map[string]bool
+
+	reads        map[string]bool     // the variables that the generated code reads
+	implies      map[string][]string // the variables read by the declaration of a variable, if it is written
+	placeholders []placeholder       // code that depends on whether a variable is read
+}
+
+// Placeholder is code that is written once it is known whether a variable is read, since Go rejects
+// variables that are declared and never read.
+type placeholder struct {
+	name         string // the variable
+	read, unread string // the code written if the variable is read, and if it is not
+}
+
+// PartialKey identifies a partial by its name and the indentation of the standalone tag including it.
+type partialKey struct {
+	name, indent string
+}
+
+// Generate returns the source of a Go file declaring funcName, which renders the template with a *typeName.
+func generate(p *pkg, src, name, typeName, funcName string, loader mustache.PartialLoader) ([]byte, error) {
+	t := p.lookup(typeName)
+	if t == nil {
+		return nil, fmt.Errorf("type %s is not declared in package %s", typeName, p.name)
+	}
+
+	tmpl, err := mustache.Compile(src, mustache.Name(name), mustache.Partials(loader))
+	if err != nil {
+		return nil, err
+	}
+
+	g := &generator{
+		pkg:       p,
+		loader:    loader,
+		funcName:  funcName,
+		name:      name,
+		inlining:  make(map[string]bool),
+		templates: make(map[partialKey][]mustache.Node),
+		delims:    make(map[*mustache.Section][2]string),
+		funcs:     make(map[partialKey]string),
+		leading:   make(map[partialKey][]partialKey),
+		imports:   map[string]bool{"fmt": true, "io": true},
+		reads:     make(map[string]bool),
+		implies:   make(map[string][]string),
+	}
+
+	root := frame{expr: "d", typ: opaque}
+	if t.kind != dynamicKind {
+		root = frame{expr: "d", typ: &goType{kind: pointerKind, expr: "*" + t.expr, elem: t}, nilable: true}
+	}
+	nodes := g.record(tmpl.Nodes())
+	body := g.capture(func() {
+		g.nodes(nodes, []frame{root}, "")
+	})
+
+	var funcs bytes.Buffer
+	for len(g.queue) > 0 {
+		partial := g.queue[0]
+		g.queue = g.queue[1:]
+		funcs.WriteString(g.partialFunc(partial))
+	}
+	if g.err != nil {
+		return nil, g.err
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by mustache-gen from %s. DO NOT EDIT.\n\npackage %s\n\nimport (\n", name, p.name)
+	imports := make([]string, 0, len(g.imports))
+	for path := range g.imports {
+		if path != "mustache" && path != "genrt" {
+			imports = append(imports, path)
+		}
+	}
+	sort.Strings(imports)
+	for _, path := range imports {
+		fmt.Fprintf(&out, "%q\n", path)
+	}
+	if g.imports["mustache"] || g.imports["genrt"] {
+		out.WriteString("\n")
+	}
+	if g.imports["mustache"] {
+		fmt.Fprintf(&out, "mustache %q\n", "github.com/smarden1/mustache.go")
+	}
+	if g.imports["genrt"] {
+		fmt.Fprintf(&out, "%q\n", "github.com/smarden1/mustache.go/genrt")
+	}
+	fmt.Fprintf(&out, ")\n\n")
+
+	fmt.Fprintf(&out, "// %s renders the %s template with d, writing the same output as the template would.\n", funcName, name)
+	fmt.Fprintf(&out, "func %s(w io.Writer, d *%s) (err error) {\n", funcName, typeName)
+	fmt.Fprintf(&out, "defer func() {\nif p := recover(); p != nil {\nerr = fmt.Errorf(\"%%s Render error: panic while rendering: %%v\", %q, p)\n}\n}()\n\n", name)
+	out.WriteString(body)
+	fmt.Fprintf(&out, "\nreturn nil\n}\n")
+	out.Write(funcs.Bytes())
+
+	return format.Source(g.fill(out.Bytes()))
+}
+
+// Fail records the first error found.
+func (g *generator) fail(format string, args ...interface{}) {
+	if g.err == nil {
+		g.err = fmt.Errorf(format, args...)
+	}
+}
+
+// Printf writes code.
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(g.buf, format, args...)
+}
+
+// Capture returns the code written by fn, rather than writing it.
+func (g *generator) capture(fn func()) string {
+	buf := g.buf
+	g.buf = &bytes.Buffer{}
+	fn()
+	code := g.buf.String()
+	g.buf = buf
+
+	return code
+}
+
+// NewVar returns the name of a new variable.
+func (g *generator) newVar(prefix string) string {
+	g.vars++
+	return fmt.Sprintf("%s%d", prefix, g.vars)
+}
+
+// Read records that the generated code reads the variable held by expr and returns expr.
+// Reads must be recorded as the code reading the variable is written, since it is only declared if it is read.
+func (g *generator) read(expr string) string {
+	g.reads[expr] = true
+	return expr
+}
+
+// IfRead returns a placeholder for code that is either read or unread, depending on whether the variable is read.
+func (g *generator) ifRead(name, read, unread string) string {
+	g.placeholders = append(g.placeholders, placeholder{name: name, read: read, unread: unread})
+	return fmt.Sprintf("\x00%d\x00", len(g.placeholders)-1)
+}
+
+// Declare writes the declaration of a variable, which is left out if the variable is never read.
+func (g *generator) declare(name, typ string) {
+	g.printf("%s", g.ifRead(name, fmt.Sprintf("var %s %s\n", name, typ), ""))
+}
+
+// Target returns the variable for assigning to, which is _ if it is never read and so not declared.
+func (g *generator) target(name string) string {
+	return g.ifRead(name, name, "_")
+}
+
+// Fill replaces the placeholders in the code, now that it is known which variables are read.
+func (g *generator) fill(code []byte) []byte {
+	// reads made by a declaration only happen if the declared variable is read
+	for changed := true; changed; {
+		changed = false
+		for name, implied := range g.implies {
+			for _, v := range implied {
+				if g.reads[name] && !g.reads[v] {
+					g.reads[v] = true
+					changed = true
+				}
+			}
+		}
+	}
+
+	pairs := make([]string, 0, 2*len(g.placeholders))
+	for i, p := range g.placeholders {
+		text := p.unread
+		if g.reads[p.name] {
+			text = p.read
+		}
+		pairs = append(pairs, fmt.Sprintf("\x00%d\x00", i), text)
+	}
+
+	return []byte(strings.NewReplacer(pairs...).Replace(string(code)))
+}
+
+// Use records that the generated code uses the mustache package and returns its name.
+func (g *generator) use() string {
+	g.imports["mustache"] = true
+	return "mustache"
+}
+
+// Runtime records that the generated code uses the genrt package, which holds the helpers
+// for values whose types are only known at runtime, and returns its name.
+func (g *generator) runtime() string {
+	g.imports["genrt"] = true
+	return "genrt"
+}
+
+// Write writes the code that writes the string held by expr to w.
+func (g *generator) write(expr string) {
+	g.printf("if _, err := io.WriteString(w, %s); err != nil {\nreturn err\n}\n", expr)
+}
+
+// Stack returns an expression holding the context stack as a slice, as the helpers of genrt expect it.
+func (g *generator) stack(frames []frame, cstack string) string {
+	if cstack != "" {
+		return g.read(cstack)
+	}
+
+	exprs := make([]string, len(frames))
+	for i, f := range frames {
+		exprs[i] = g.read(f.expr)
+	}
+
+	return "[]interface{}{" + strings.Join(exprs, ", ") + "}"
+}
+
+// LookupError returns an expression creating the error returned when looking up the key fails, the same as the package's.
+func (g *generator) lookupError(pos mustache.Pos, key, tag string) string {
+	prefix := fmt.Sprintf("%d:%d:", pos.Line, pos.Column)
+	if g.name != "" {
+		prefix = g.name + ":" + prefix
+	}
+
+	return fmt.Sprintf("fmt.Errorf(\"%%s: %%w\", %q, err)", fmt.Sprintf("%s Render error: %s returned an error for %s", prefix, key, tag))
+}
+
+// Record notes the delimiters that each section in the nodes was written with.
+func (g *generator) record(nodes []mustache.Node) []mustache.Node {
+	otag, ctag := "{{", "}}"
+	mustache.Inspect(func(n mustache.Node) bool {
+		switch n := n.(type) {
+		case *mustache.SetDelimiter:
+			otag, ctag = n.Open, n.Close
+		case *mustache.Section:
+			g.delims[n] = [2]string{otag, ctag}
+		}
+		return true
+	}, nodes...)
+
+	return nodes
+}
+
+// Load returns the nodes of the partial, compiling it with each line indented on first use, or nil if it does not exist.
+func (g *generator) load(key partialKey) []mustache.Node {
+	if nodes, ok := g.templates[key]; ok {
+		return nodes
+	}
+
+	name := key.name
+	src, err := g.loader.Load(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		src, err = "", nil
+	}
+	if err != nil {
+		g.fail("partial %s could not be loaded: %w", name, err)
+		return nil
+	}
+
+	var nodes []mustache.Node
+	if src != "" {
+		tmpl, err := mustache.Compile(indentLines(src, key.indent), mustache.Name(name))
+		if err != nil {
+			g.fail("%w", err)
+			return nil
+		}
+		nodes = g.record(tmpl.Nodes())
+	}
+	g.templates[key] = nodes
+
+	return nodes
+}
+
+// IndentLines prefixes each line of the source of a standalone partial with the indentation of its tag, as the package does.
+func indentLines(src, indent string) string {
+	if indent == "" {
+		return src
+	}
+
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(src, "\n") {
+		if line != "" {
+			b.WriteString(indent)
+			b.WriteString(line)
+		}
+	}
+
+	return b.String()
+}
+
+// Nodes writes the code that renders each of the nodes in turn.
+// The contexts are either held by the frames, or by the slice named by cstack, in which case every name is looked up at runtime.
+func (g *generator) nodes(nodes []mustache.Node, frames []frame, cstack string) {
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *mustache.Text:
+			g.write(strconv.Quote(n.Text))
+		case *mustache.Variable:
+			g.variable(n, frames, cstack)
+		case *mustache.Section:
+			g.section(n, frames, cstack)
+		case *mustache.InvertedSection:
+			g.inverted(n, frames, cstack)
+		case *mustache.Partial:
+			if n.Dynamic {
+				g.fail("%s includes the dynamic partial *%s, which is not supported", g.name, n.Name)
+				continue
+			}
+			g.partial(partialKey{n.Name, n.Indent}, frames, cstack)
+		case *mustache.Parent:
+			g.parent(n, frames, cstack)
+		case *mustache.Block:
+			g.block(n, frames, cstack)
+		}
+	}
+}
+
+// Variable writes the code for an interpolation.
+func (g *generator) variable(n *mustache.Variable, frames []frame, cstack string) {
+	val := g.resolve(n.Name, frames, cstack, g.lookupError(n.Pos, n.Name, n.Tag))
+	if val.ok == "false" {
+		return
+	}
+
+	g.printf("if %s {\n", g.read(val.ok))
+	var s string
+	switch t := val.typ; {
+	case t.kind == basicKind && !t.named && t.basic == "string":
+		s = g.read(val.expr)
+	case t.kind == basicKind && !t.named && t.basic == "bool":
+		g.imports["strconv"] = true
+		s = fmt.Sprintf("strconv.FormatBool(%s)", g.read(val.expr))
+	case t.kind == basicKind && !t.named && strings.HasPrefix(t.basic, "int"):
+		g.imports["strconv"] = true
+		s = fmt.Sprintf("strconv.FormatInt(int64(%s), 10)", g.read(val.expr))
+	case t.kind == basicKind && !t.named && strings.HasPrefix(t.basic, "uint"):
+		g.imports["strconv"] = true
+		s = fmt.Sprintf("strconv.FormatUint(uint64(%s), 10)", g.read(val.expr))
+	case t.kind == dynamicKind || t.expr == "func() string":
+		// lambdas are rendered with the context stack
+		s = "s"
+		g.printf("s, err := %s.Interpolate(%s, %s)\nif err != nil {\nreturn err\n}\n", g.runtime(), g.stack(frames, cstack), g.read(val.expr))
+	default:
+		s = fmt.Sprintf("%s.Format(%s)", g.runtime(), g.read(val.expr))
+	}
+	if n.Escaped {
+		s = fmt.Sprintf("%s.EscapeHTML(%s)", g.use(), s)
+	}
+	g.write(s)
+	g.printf("}\n")
+}
+
+// Section writes the code for a section, which renders its nodes once for each item of a list,
+// or once with the value as a context if it is truthy.
+func (g *generator) section(n *mustache.Section, frames []frame, cstack string) {
+	val := g.resolve(n.Name, frames, cstack, g.lookupError(n.Pos, n.Name, n.Tag))
+	if val.ok == "false" {
+		return
+	}
+
+	g.printf("if %s {\n", g.read(val.ok))
+	t := val.typ
+	switch {
+	case t.kind == funcKind && t.expr != "func() string":
+		g.lambda(n, val, frames, cstack)
+	case t.kind == dynamicKind, t.kind == pointerKind && t.elem.kind != structKind:
+		if t.kind == dynamicKind {
+			g.printf("if %s.IsLambda(%s) {\n", g.runtime(), g.read(val.expr))
+			g.lambda(n, val, frames, cstack)
+			g.printf("} else ")
+		}
+		g.printf("if %s.Truthy(%s) {\n", g.runtime(), g.read(val.expr))
+		item := g.newVar("i")
+		g.printf("for %srange %s.Items(%s) {\n", g.ifRead(item, "_, "+item+" := ", ""), g.runtime(), g.read(val.expr))
+		g.push(n.Nodes, frames, cstack, frame{expr: item, typ: dynamic})
+		g.printf("}\n}\n")
+	case t.kind == sliceKind || t.kind == arrayKind:
+		item := g.newVar("i")
+		g.printf("for %srange %s {\n", g.ifRead(item, "_, "+item+" := ", ""), g.read(val.expr))
+		g.push(n.Nodes, frames, cstack, frame{expr: item, typ: t.elem, nilable: t.elem.kind == pointerKind})
+		g.printf("}\n")
+	default:
+		g.printf("if %s {\n", g.truthy(val))
+		g.push(n.Nodes, frames, cstack, frame{expr: val.expr, typ: t})
+		g.printf("}\n")
+	}
+	g.printf("}\n")
+}
+
+// Lambda writes the code that calls a section lambda with the raw text of the section.
+func (g *generator) lambda(n *mustache.Section, val value, frames []frame, cstack string) {
+	delims := g.delims[n]
+	g.printf("if err := %s.RenderLambda(w, %s, %s, %q, %q, %q); err != nil {\nreturn err\n}\n", g.runtime(), g.stack(frames, cstack), g.read(val.expr), n.Text, delims[0], delims[1])
+}
+
+// Push writes the code that renders the nodes with another context on the stack.
+func (g *generator) push(nodes []mustache.Node, frames []frame, cstack string, f frame) {
+	if cstack != "" {
+		next := g.newVar("c")
+		g.printf("%s", g.ifRead(next, fmt.Sprintf("%s := append(%s[:len(%s):len(%s)], %s)\n", next, cstack, cstack, cstack, f.expr), ""))
+		g.implies[next] = []string{cstack, f.expr}
+		g.nodes(nodes, nil, next)
+		return
+	}
+
+	g.nodes(nodes, append(frames[:len(frames):len(frames)], f), "")
+}
+
+// Inverted writes the code for an inverted section, which renders its nodes if the value is not found or is falsey.
+func (g *generator) inverted(n *mustache.InvertedSection, frames []frame, cstack string) {
+	val := g.resolve(n.Name, frames, cstack, g.lookupError(n.Pos, n.Name, n.Tag))
+	if val.ok == "false" {
+		g.printf("{\n")
+	} else if truthy := g.truthy(val); truthy == "true" {
+		g.printf("if !%s {\n", g.read(val.ok))
+	} else {
+		g.printf("if !%s || !(%s) {\n", g.read(val.ok), truthy)
+	}
+	g.nodes(n.Nodes, frames, cstack)
+	g.printf("}\n")
+}
+
+// Truthy returns an expression that is true if a section would be rendered for the value, as isFalsey decides it.
+func (g *generator) truthy(val value) string {
+	t := val.typ
+	switch t.kind {
+	case basicKind:
+		switch {
+		case t.named:
+		case t.basic == "string":
+			return g.read(val.expr) + ` != ""`
+		case t.basic == "bool":
+			return g.read(val.expr)
+		default:
+			// numbers are never empty
+			return "true"
+		}
+	case sliceKind, arrayKind, mapKind:
+		return "len(" + g.read(val.expr) + ") != 0"
+	case funcKind:
+		return g.read(val.expr) + " != nil"
+	case pointerKind:
+		if t.elem.kind == structKind && !t.elem.stringer {
+			return g.read(val.expr) + " != nil"
+		}
+	case structKind:
+		if !t.stringer {
+			return "true"
+		}
+	}
+
+	return fmt.Sprintf("%s.Truthy(%s)", g.runtime(), g.read(val.expr))
+}
+
+// Partial writes the code for a partial. Partials are written inline, unless they include
+// themselves, in which case a function is written for them.
+func (g *generator) partial(key partialKey, frames []frame, cstack string) {
+	name := key.name
+	if (cstack != "" || g.inlining[name]) && len(g.blocks) == 0 {
+		depth := strconv.Itoa(g.depth)
+		if g.depthBase != "" {
+			depth = fmt.Sprintf("%s+%d", g.depthBase, g.depth)
+		}
+		g.printf("if err := %s(w, %s, %s); err != nil {\nreturn err\n}\n", g.partialFuncName(key), g.stack(frames, cstack), depth)
+		return
+	}
+	if g.inlining[name] {
+		g.fail("%s includes itself within a parent, which is not supported", name)
+		return
+	}
+
+	g.inline(key, frames, cstack)
+}
+
+// Inline writes the code that renders a partial in place.
+func (g *generator) inline(key partialKey, frames []frame, cstack string) {
+	name := key.name
+	nodes := g.load(key)
+	if nodes == nil {
+		return
+	}
+
+	parentName := g.name
+	g.name = name
+	g.inlining[name] = true
+	g.depth++
+	g.nodes(nodes, frames, cstack)
+	g.depth--
+	delete(g.inlining, name)
+	g.name = parentName
+}
+
+// Parent writes the code for a parent, which is the parent template written inline with its blocks overridden.
+func (g *generator) parent(n *mustache.Parent, frames []frame, cstack string) {
+	if g.inlining[n.Name] {
+		g.fail("%s includes itself as a parent, which is not supported", n.Name)
+		return
+	}
+
+	overrides := make(map[string]*mustache.Block)
+	for _, child := range n.Nodes {
+		if block, ok := child.(*mustache.Block); ok {
+			overrides[block.Name] = block
+		}
+	}
+
+	g.blocks = append(g.blocks, overrides)
+	g.inline(partialKey{name: n.Name, indent: n.Indent}, frames, cstack)
+	g.blocks = g.blocks[:len(g.blocks)-1]
+}
+
+// Block writes the code for a block, the outermost override of it or its own nodes.
+func (g *generator) block(n *mustache.Block, frames []frame, cstack string) {
+	for _, overrides := range g.blocks {
+		if override, ok := overrides[n.Name]; ok {
+			if override.Indent == n.Indent {
+				g.nodes(override.Nodes, frames, cstack)
+				return
+			}
+
+			// the override is indented as the block, so it is written through the runtime
+			g.printf("if err := %s.Reindent(w, %q, %q, func(w io.Writer) error {\n", g.runtime(), override.Indent, n.Indent)
+			g.nodes(override.Nodes, frames, cstack)
+			g.printf("return nil\n}); err != nil {\nreturn err\n}\n")
+			return
+		}
+	}
+
+	g.nodes(n.Nodes, frames, cstack)
+}
+
+// PartialFuncName returns the name of the function rendering the partial, queuing it to be written on first use.
+// A partial that includes itself with more indentation would need a function for every level, which is not supported.
+func (g *generator) partialFuncName(key partialKey) string {
+	if fn, ok := g.funcs[key]; ok {
+		return fn
+	}
+	for _, k := range g.writing {
+		if k.name == key.name && k.indent != key.indent {
+			g.fail("%s includes itself with more indentation, which is not supported", key.name)
+			return "nil"
+		}
+	}
+
+	fn := fmt.Sprintf("%sPartial%d", lowerFirst(g.funcName), len(g.funcs))
+	g.funcs[key] = fn
+	g.leading[key] = g.writing
+	g.queue = append(g.queue, key)
+
+	return fn
+}
+
+// PartialFunc returns the function rendering the partial with a context stack that is only known at runtime.
+func (g *generator) partialFunc(key partialKey) string {
+	name := key.name
+	g.name, g.depth, g.depthBase = name, 1, "depth"
+	g.writing = append(g.leading[key][:len(g.leading[key]):len(g.leading[key])], key)
+	body := g.capture(func() {
+		g.nodes(g.load(key), nil, "cstack")
+	})
+
+	var out bytes.Buffer
+	fn := g.funcs[key]
+	fmt.Fprintf(&out, "\n// %s renders the %s partial for %s, looking up each name at runtime.\n", fn, name, g.funcName)
+	fmt.Fprintf(&out, "func %s(w io.Writer, cstack []interface{}, depth int) error {\n", fn)
+	fmt.Fprintf(&out, "if depth >= %d {\nreturn fmt.Errorf(\"Render error: %%s exceeded the maximum partial depth of %%d\", %q, %d)\n}\n\n", maxPartialDepth, name, maxPartialDepth)
+	out.WriteString(body)
+	fmt.Fprintf(&out, "\nreturn nil\n}\n")
+
+	return out.String()
+}
+
+// Resolve writes the code that looks up a name, as contextStackContains would, and returns the value.
+// The ok expression of the value is false if the name can never be found.
+func (g *generator) resolve(name string, frames []frame, cstack, fail string) value {
+	if cstack != "" {
+		v, ok := g.newVar("v"), g.newVar("ok")
+		g.declare(v, "interface{}")
+		g.declare(ok, "bool")
+		g.printf("if x, found, err := %s.Lookup(%s, %q); err != nil {\nreturn %s\n} else if found {\n%s, %s = x, true\n}\n", g.runtime(), g.read(cstack), name, fail, g.target(v), g.target(ok))
+		return value{expr: v, ok: ok, typ: dynamic}
+	}
+	if name == "." {
+		top := frames[len(frames)-1]
+		return value{expr: top.expr, ok: "true", typ: top.typ}
+	}
+
+	v, ok := g.newVar("v"), g.newVar("ok")
+	var found []*goType
+	code := g.capture(func() {
+		emitted, always := g.chain(frames, name, v, ok, fail, &found)
+		if always || !strings.Contains(name, ".") {
+			return
+		}
+
+		// a dotted name is looked up one part at a time if it is not found as a whole
+		if emitted {
+			g.printf("if !%s {\n", g.read(ok))
+		}
+		opened := 0
+		search := frames
+		parts := strings.Split(name, ".")
+		for i, part := range parts {
+			val := g.resolve(part, search, "", fail)
+			if val.ok == "false" {
+				break
+			}
+			if i == len(parts)-1 {
+				g.printf("if %s {\n%s, %s = %s, true\n}\n", g.read(val.ok), g.target(v), g.target(ok), g.read(val.expr))
+				found = append(found, val.typ)
+				break
+			}
+			g.printf("if %s {\n", g.read(val.ok))
+			opened++
+			search = []frame{{expr: val.expr, typ: val.typ, nilable: val.typ.kind == pointerKind}}
+		}
+		g.printf("%s", strings.Repeat("}\n", opened))
+		if emitted {
+			g.printf("}\n")
+		}
+	})
+	if len(found) == 0 {
+		return value{ok: "false", typ: opaque}
+	}
+
+	typ := unify(found)
+	g.declare(v, typ.expr)
+	g.declare(ok, "bool")
+	g.buf.WriteString(code)
+
+	return value{expr: v, ok: ok, typ: typ}
+}
+
+// Chain writes the code that looks up a key in each of the frames in turn, from the top of the stack,
+// until it is found. It returns whether any code was written and whether the key is always found.
+func (g *generator) chain(frames []frame, key, v, ok, fail string, found *[]*goType) (bool, bool) {
+	emitted := false
+	for i := len(frames) - 1; i >= 0; i-- {
+		for _, s := range g.steps(frames[i], key, fail) {
+			if emitted {
+				g.printf("if !%s {\n", g.read(ok))
+			}
+			s.emit(g.target(v), g.target(ok))
+			if emitted {
+				g.printf("}\n")
+			}
+			emitted = true
+			*found = append(*found, s.typ)
+			if s.always {
+				return true, true
+			}
+		}
+	}
+
+	return emitted, false
+}
+
+// Steps returns the steps that look up a key in a single context, in the order lookupKey tries them.
+// Fail is the expression returned if a method called fails.
+func (g *generator) steps(f frame, key, fail string) []step {
+	t := f.typ
+	if t.kind == dynamicKind {
+		return []step{{typ: dynamic, emit: func(v, ok string) {
+			g.printf("if x, found, err := %s.LookupKey(%s, %q); err != nil {\nreturn %s\n} else if found {\n%s, %s = x, true\n}\n", g.runtime(), g.read(f.expr), key, fail, v, ok)
+		}}}
+	}
+
+	var steps []step
+	if t.kind == pointerKind {
+		// the methods of the pointer, then those of the value it points to
+		if m, ok := t.elem.methods[key]; ok {
+			steps = append(steps, g.call(f.expr, key, m, false, fail))
+		} else if m, ok := t.elem.ptrMethods[key]; ok {
+			steps = append(steps, g.call(f.expr, key, m, false, fail))
+		} else if t.elem.kind == mapKind {
+			steps = g.members(t.elem, "(*"+f.expr+")", key, fail)
+			for i := range steps {
+				emit := steps[i].emit
+				steps[i].emit = func(v, ok string) {
+					g.read(f.expr)
+					emit(v, ok)
+				}
+			}
+		} else {
+			steps = g.members(t.elem, f.expr, key, fail)
+		}
+	} else {
+		steps = g.members(t, f.expr, key, fail)
+	}
+
+	if f.nilable && t.kind == pointerKind && len(steps) > 0 {
+		// a nil pointer is skipped over
+		for i := range steps {
+			emit := steps[i].emit
+			steps[i].emit = func(v, ok string) {
+				g.printf("if %s != nil {\n", g.read(f.expr))
+				emit(v, ok)
+				g.printf("}\n")
+			}
+			steps[i].always = false
+		}
+	}
+
+	return steps
+}
+
+// Members returns the steps that look up a key in a value of the type, which is held by expr.
+func (g *generator) members(t *goType, expr, key, fail string) []step {
+	var steps []step
+	switch t.kind {
+	case mapKind:
+		if t.key.kind == basicKind && t.key.basic == "string" {
+			steps = append(steps, step{typ: t.elem, emit: func(v, ok string) {
+				g.printf("if x, found := %s[%q]; found {\n%s, %s = x, true\n}\n", g.read(expr), key, v, ok)
+			}})
+		}
+	case structKind:
+		if field, ok := t.fieldNames[key]; ok {
+			return []step{{typ: t.fields[key], always: true, emit: func(v, ok string) {
+				g.printf("%s, %s = %s.%s, true\n", v, ok, g.read(expr), field)
+			}}}
+		}
+		if m, ok := t.ptrMethods[key]; ok {
+			return []step{g.call(expr, key, m, true, fail)}
+		}
+	}
+	if m, ok := t.methods[key]; ok {
+		steps = append(steps, g.call(expr, key, m, false, fail))
+	}
+
+	return steps
+}
+
+// Call returns the step that calls a method. A copy of the value is made first if it needs to be addressable.
+func (g *generator) call(expr, key string, m method, copy bool, fail string) step {
+	return step{typ: m.typ, always: !m.err, emit: func(v, ok string) {
+		recv := g.read(expr)
+		if copy {
+			g.printf("{\nc := %s\n", recv)
+			recv = "c"
+		}
+		if m.err {
+			g.printf("if x, err := %s.%s(); err != nil {\nreturn %s\n} else {\n%s, %s = x, true\n}\n", recv, key, fail, v, ok)
+		} else {
+			g.printf("%s, %s = %s.%s(), true\n", v, ok, recv, key)
+		}
+		if copy {
+			g.printf("}\n")
+		}
+	}}
+}
+
+// Unify returns the type of a variable that can hold values of all of the types.
+func unify(types []*goType) *goType {
+	for _, t := range types[1:] {
+		if t.expr != types[0].expr {
+			return dynamic
+		}
+	}
+	if types[0].kind == dynamicKind {
+		return dynamic
+	}
+
+	return types[0]
+}
+
+// LowerFirst returns the name with its first letter in lower case.
+func lowerFirst(name string) string {
+	for i, r := range name {
+		return string(unicode.ToLower(r)) + name[i+len(string(r)):]
+	}
+
+	return name
+}
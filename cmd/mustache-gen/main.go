@@ -0,0 +1,81 @@
+// Mustache-gen compiles a mustache template into a Go function that renders it with a value of a Go type.
+//
+// The function reads fields and calls methods directly rather than looking them up with reflection,
+// and writes the same output as rendering the template would. It is intended to be used with go generate,
+//
+//	//go:generate mustache-gen -template email.mustache -type Email
+//
+// which writes email_mustache.go declaring
+//
+//	func RenderEmail(w io.Writer, d *Email) error
+//
+// The type is read from the Go files of the package in the current directory. Names that are looked up
+// in values whose type can not be known when generating, such as interface{} values, maps of them and
+// types from other packages, are looked up at runtime in the same way as the package does.
+//
+// Partials are read from the directory of the template when generating, so the generated code must be
+// regenerated when they change. Lambdas are rendered with the default options of the package.
+// The template is rendered with the default options, so filters, missing key modes and the
+// iteration options are not supported, and nor are dynamic partials since their names are only known when rendering.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	mustache "github.com/smarden1/mustache.go"
+)
+
+func main() {
+	templatePath := flag.String("template", "", "the template to compile")
+	typeName := flag.String("type", "", "the type of the data the template is rendered with")
+	funcName := flag.String("func", "", "the name of the function to generate, Render followed by the type by default")
+	partials := flag.String("partials", "", "the directory partials are read from, the directory of the template by default")
+	dir := flag.String("dir", ".", "the directory of the package declaring the type")
+	output := flag.String("o", "", "the file to write, the name of the template followed by _mustache.go by default")
+	flag.Parse()
+
+	if *templatePath == "" || *typeName == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	name := strings.TrimSuffix(filepath.Base(*templatePath), filepath.Ext(*templatePath))
+	if *funcName == "" {
+		*funcName = "Render" + *typeName
+	}
+	if *partials == "" {
+		*partials = filepath.Dir(*templatePath)
+	}
+	if *output == "" {
+		*output = filepath.Join(*dir, name+"_mustache.go")
+	}
+
+	if err := run(*templatePath, name, *typeName, *funcName, *partials, *dir, *output); err != nil {
+		fmt.Fprintf(os.Stderr, "mustache-gen: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// Run generates the function for the template and writes it to the output file.
+func run(templatePath, name, typeName, funcName, partials, dir, output string) error {
+	src, err := os.ReadFile(templatePath)
+	if err != nil {
+		return err
+	}
+
+	p, err := parsePackage(dir, output)
+	if err != nil {
+		return err
+	}
+
+	code, err := generate(p, string(src), name, typeName, funcName, mustache.DirLoader(partials))
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(output, code, 0666)
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	mustache "github.com/smarden1/mustache.go"
+)
+
+// genTypes are the types the templates are rendered with.
+const genTypes = `package main
+
+import (
+	"errors"
+	"time"
+)
+
+type Order struct {
+	ID       int
+	Customer *Customer ` + "`json:\"customer\"`" + `
+	Items    []*Item
+	Tags     []string
+	Notes    map[string]string
+	Extra    interface{}
+	Status   Status
+	Total    float64
+	Paid     bool
+	Created  time.Time
+	Lambda   func(string) string
+	Bold     func() string
+	Children []Order
+}
+
+type Customer struct {
+	First string ` + "`mustache:\"first\"`" + `
+	Last  string ` + "`json:\"last\"`" + `
+	email string
+}
+
+func (c Customer) Name() string {
+	return c.First + " " + c.Last
+}
+
+func (c *Customer) Initials() (string, error) {
+	if c.First == "" || c.Last == "" {
+		return "", errors.New("no name")
+	}
+	return c.First[:1] + c.Last[:1], nil
+}
+
+type Item struct {
+	Name  string
+	Price float64
+	Qty   uint
+}
+
+func (i Item) Total() float64 {
+	return i.Price * float64(i.Qty)
+}
+
+type Status string
+
+func (s Status) String() string {
+	if s == "" {
+		return ""
+	}
+	return "status:" + string(s)
+}
+
+type Data map[string]interface{}
+
+func data(s string) *Data {
+	var d Data
+	if err := json.Unmarshal([]byte(s), &d); err != nil {
+		panic(err)
+	}
+	return &d
+}
+`
+
+// genOrder builds the order most of the templates are rendered with.
+const genOrder = `&Order{
+	ID:       7,
+	Customer: &Customer{First: "Ada", Last: "Lovelace", email: "ada@example.com"},
+	Items:    []*Item{{Name: "pen", Price: 1.5, Qty: 2}, nil, {Name: "<ink>", Price: 3, Qty: 1}},
+	Tags:     []string{"new", "gift"},
+	Notes:    map[string]string{"a": "note a", "html": "<&\"'>"},
+	Extra:    map[string]interface{}{"list": []interface{}{1, "two", map[string]interface{}{"x": "<x>"}}, "n": nil},
+	Status:   "open",
+	Total:    4.5,
+	Paid:     true,
+	Created:  time.Date(2015, 10, 23, 0, 0, 0, 0, time.UTC),
+	Lambda:   func(s string) string { return "<b>" + s + "</b>" },
+	Bold:     func() string { return "{{ID}}" },
+	Children: []Order{{ID: 8, Children: []Order{{ID: 9}}}, {ID: 10}},
+}`
+
+type genCase struct {
+	template string
+	partials map[string]string
+	typ      string
+	data     string // Go expression building the data
+}
+
+func TestGenerate(t *testing.T) {
+	cases := []genCase{
+		{"{{ID}} {{customer.first}} {{customer.last}} {{Customer.Name}} {{Customer.Initials}} {{Customer.email}}", nil, "Order", genOrder},
+		{"{{#Items}}{{Name}}: {{Price}} x {{Qty}} = {{Total}} {{ID}}\n{{/Items}}", nil, "Order", genOrder},
+		{"{{#Tags}}<{{.}}>{{/Tags}}{{^Tags}}none{{/Tags}}", nil, "Order", genOrder},
+		{"{{#Tags}}<{{.}}>{{/Tags}}{{^Tags}}none{{/Tags}}", nil, "Order", "&Order{}"},
+		{"{{Notes.a}} {{#Notes}}{{a}}{{/Notes}} {{Notes.missing}}|{{Notes.html}} {{{Notes.html}}} {{&Notes.html}}", nil, "Order", genOrder},
+		{"{{#Extra.list}}{{.}}{{x}}{{/Extra.list}} {{Extra.n}} {{^Extra.n}}nil{{/Extra.n}}", nil, "Order", genOrder},
+		{"{{Status}} {{#Status}}yes{{/Status}}{{^Status}}no{{/Status}}", nil, "Order", genOrder},
+		{"{{Status}} {{#Status}}yes{{/Status}}{{^Status}}no{{/Status}}", nil, "Order", "&Order{}"},
+		{"{{Total}} {{Paid}} {{#Paid}}paid{{/Paid}}{{^Paid}}unpaid{{/Paid}} {{Created.Year}}", nil, "Order", genOrder},
+		{"{{#Lambda}}Hi {{customer.first}}{{/Lambda}} {{Bold}}", nil, "Order", genOrder},
+		{"{{=<% %>=}}<% ID %> <%#Lambda%>x<% ID %><%/Lambda%>", nil, "Order", genOrder},
+		{"{{> order}}", map[string]string{"order": "{{ID}}({{#Children}}{{> order}}{{/Children}})"}, "Order", genOrder},
+		{"{{#Customer}}{{> name}}{{/Customer}}{{> missing}}", map[string]string{"name": "{{first}} {{ID}}"}, "Order", genOrder},
+		{"{{<layout}}{{$title}}Order {{ID}}{{/title}}{{/layout}}", map[string]string{"layout": "<h1>{{$title}}Default{{/title}}</h1>{{$body}}body{{/body}}"}, "Order", genOrder},
+		{"{{ID}}{{^ID}}none{{/ID}}[{{.}}]{{#Customer}}x{{/Customer}}", nil, "Order", "(*Order)(nil)"},
+		{"{{^missing}}m{{/missing}}{{customer.missing}}{{Customer.Name.x}}{{#missing}}x{{/missing}}", nil, "Order", genOrder},
+		{"{{Customer.Initials}}", nil, "Order", "&Order{Customer: &Customer{}}"},
+		{"{{& Customer.Initials }}{{=<% %>=}}<%# Customer.Initials %>x<%/ Customer.Initials %>", nil, "Order", "&Order{Customer: &Customer{}}"},
+		{"{{=<% %>=}}<%^ Customer.Initials %>x<%/ Customer.Initials %>", nil, "Order", "&Order{Customer: &Customer{}}"},
+		{"{{#Customer}}{{Initials}} {{Name}} {{last}} {{ID}}{{/Customer}}", nil, "Order", genOrder},
+		{"{{#Children}}{{#Children}}{{ID}}{{/Children}}{{^Children}}-{{ID}}{{/Children}}{{/Children}}", nil, "Order", genOrder},
+		{"{{a.b}} {{#list}}{{.}}{{/list}} {{#a}}{{b}}{{c}}{{/a}}", nil, "Data", `data("{\"a\": {\"b\": \"<b>\"}, \"c\": 1, \"list\": [1, 2.5, \"x\"]}")`},
+		{"items:\n  {{> items}}\nid: {{ID}}", map[string]string{"items": "{{#Items}}\n- {{> item}}\n{{/Items}}\n", "item": "name: {{Name}}\n  qty: {{Qty}}\n"}, "Order", genOrder},
+		{"orders:\n  {{> order}}\n", map[string]string{"order": "- {{ID}}\n{{#Children}}\n{{> order}}\n{{/Children}}\n"}, "Order", genOrder},
+		{"<ul>\n  {{<list}}{{/list}}\n</ul>\n{{<list}}\n{{$item}}\n    {{#Items}}<li>{{Name}}</li>{{/Items}}\n{{/item}}\n{{/list}}", map[string]string{"list": "<li>\n  {{$item}}\n  {{ID}}\n  {{/item}}\n</li>\n"}, "Order", genOrder},
+	}
+
+	cases = append(cases, specCases(t)...)
+	runGenerated(t, cases)
+}
+
+// SpecCases returns a case for each of the tests in the spec files that the package runs.
+func specCases(t *testing.T) []genCase {
+	var cases []genCase
+
+	paths, _ := filepath.Glob("../../spec/specs/*.json")
+	if len(paths) == 0 {
+		t.Fatal("the spec files are missing, clone https://github.com/mustache/spec into spec")
+	}
+	for _, path := range paths {
+		name := filepath.Base(path)
+		if strings.HasPrefix(name, "~") && name != "~inheritance.json" {
+			continue
+		}
+
+		var spec struct {
+			Tests []struct {
+				Data     map[string]interface{} `json:"data"`
+				Template string                 `json:"template"`
+				Partials map[string]string      `json:"partials"`
+			} `json:"tests"`
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(b, &spec); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, test := range spec.Tests {
+			data, _ := json.Marshal(test.Data)
+			cases = append(cases, genCase{test.Template, test.Partials, "Data", fmt.Sprintf("data(%q)", data)})
+		}
+	}
+
+	return cases
+}
+
+// RunGenerated generates a function for each case and checks that it writes the same output as the template.
+func runGenerated(t *testing.T, cases []genCase) {
+	if testing.Short() {
+		t.Skip("building the generated code is slow")
+	}
+	root, err := filepath.Abs("../..")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("go.mod", fmt.Sprintf("module gentest\n\ngo 1.24\n\nrequire github.com/smarden1/mustache.go v0.0.0\n\nreplace github.com/smarden1/mustache.go => %s\n", root))
+	write("types.go", strings.Replace(genTypes, "import (\n", "import (\n\t\"encoding/json\"\n", 1))
+
+	p, err := parsePackage(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var checks bytes.Buffer
+	for i, c := range cases {
+		name := fmt.Sprintf("case%d", i)
+		code, err := generate(p, c.template, name, c.typ, fmt.Sprintf("RenderCase%d", i), mustache.MapLoader(c.partials))
+		if err != nil {
+			t.Fatalf("Unexpected error generating %q, %s", c.template, err)
+		}
+		write(name+"_mustache.go", string(code))
+
+		fmt.Fprintf(&checks, "{%q, %q, %#v, %s, func(w io.Writer, d interface{}) error { return RenderCase%d(w, d.(*%s)) }},\n", name, c.template, c.partials, c.data, i, c.typ)
+	}
+
+	write("main.go", `package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	mustache "github.com/smarden1/mustache.go"
+)
+
+var _ = time.Now
+
+type check struct {
+	name, template string
+	partials       map[string]string
+	data           interface{}
+	render         func(io.Writer, interface{}) error
+}
+
+var checks = []check{
+`+checks.String()+`}
+
+func main() {
+	failed := false
+	for _, c := range checks {
+		tmpl, err := mustache.Compile(c.template, mustache.Name(c.name), mustache.Partials(mustache.MapLoader(c.partials)))
+		if err != nil {
+			panic(err)
+		}
+		var want, got bytes.Buffer
+		wantErr := tmpl.Execute(&want, c.data)
+		gotErr := c.render(&got, c.data)
+		if want.String() != got.String() || fmt.Sprint(wantErr) != fmt.Sprint(gotErr) {
+			fmt.Printf("%s %q: the template wrote %q (%v), the generated code wrote %q (%v)\n", c.name, c.template, want.String(), wantErr, got.String(), gotErr)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+`)
+
+	cmd := exec.Command("go", "run", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOWORK=off", "GOPROXY=off")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("The generated code did not match the template, %s\n%s", err, out)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	p := &pkg{types: make(map[string]*ast.TypeSpec), methods: make(map[string][]*ast.FuncDecl), parsed: make(map[string]*goType)}
+	f, err := parser.ParseFile(token.NewFileSet(), "types.go", "package main\n\ntype Order struct {\n\tID int\n}\n", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.add(f)
+
+	type expects struct {
+		template string
+		typ      string
+		partials map[string]string
+		expected string
+	}
+
+	tests := []expects{
+		{"{{ID}}", "Missing", nil, "type Missing is not declared in package main"},
+		{"{{#ID}}", "Order", nil, "case:1:1: Malformed template: ID was not closed"},
+		{"{{<loop}}{{/loop}}", "Order", map[string]string{"loop": "{{<loop}}{{/loop}}"}, "loop includes itself as a parent, which is not supported"},
+		{"{{#ID}}{{>*ID}}{{/ID}}", "Order", nil, "case includes the dynamic partial *ID, which is not supported"},
+		{"{{> tree}}", "Order", map[string]string{"tree": "{{#ID}}\n  {{> tree}}\n{{/ID}}"}, "tree includes itself with more indentation, which is not supported"},
+	}
+
+	for _, test := range tests {
+		_, err := generate(p, test.template, "case", test.typ, "Render", mustache.MapLoader(test.partials))
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("%s expected error %q, but got %v", test.template, test.expected, err)
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Kind is the kind of a Go type, as far as rendering is concerned.
+type kind int
+
+const (
+	dynamicKind kind = iota // interface{}, or a type the generator does not understand, looked up at runtime
+	basicKind               // strings, numbers and booleans
+	structKind
+	pointerKind
+	sliceKind
+	arrayKind
+	mapKind
+	funcKind // lambdas
+)
+
+// GoType describes a Go type well enough to generate the lookups a template makes on it.
+type goType struct {
+	kind  kind
+	expr  string // the type as written in Go, i.e. - []*Item
+	named bool   // declared in the package
+	basic string // the builtin type of basic kinds, i.e. - int64
+
+	elem *goType // of pointers, slices, arrays and maps
+	key  *goType // of maps
+
+	fields     map[string]*goType // of structs, by the names they can be looked up with
+	fieldNames map[string]string  // of structs, the Go name of each field
+	methods    map[string]method  // that can be called on values of the type
+	ptrMethods map[string]method  // that can only be called on pointers to the type
+	stringer   bool               // whether values of the type format themselves with a String or Error method
+}
+
+// Method is a method that can be used as a value by a template.
+type method struct {
+	typ *goType // the type of the value returned
+	err bool    // whether an error is also returned
+}
+
+// Dynamic is the type of interfaces, whose values are only known at runtime.
+var dynamic = &goType{kind: dynamicKind, expr: "interface{}"}
+
+// Opaque is the type of values that the generator can not name or look into, such as types
+// from other packages. They are held as interface{} values and looked up at runtime.
+var opaque = &goType{kind: dynamicKind, expr: "interface{}"}
+
+// Package holds the declarations of a Go package that the generator needs.
+type pkg struct {
+	name    string
+	types   map[string]*ast.TypeSpec
+	methods map[string][]*ast.FuncDecl // by the name of the receiver type
+	parsed  map[string]*goType
+}
+
+// ParsePackage parses the Go files in the directory, except for tests and the skipped file.
+func parsePackage(dir, skip string) (*pkg, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &pkg{types: make(map[string]*ast.TypeSpec), methods: make(map[string][]*ast.FuncDecl), parsed: make(map[string]*goType)}
+	fset := token.NewFileSet()
+	for _, path := range paths {
+		if strings.HasSuffix(path, "_test.go") || (skip != "" && sameFile(path, skip)) {
+			continue
+		}
+		f, err := parser.ParseFile(fset, path, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+		p.add(f)
+	}
+	if p.name == "" {
+		return nil, fmt.Errorf("no Go files found in %s", dir)
+	}
+
+	return p, nil
+}
+
+// SameFile returns a boolean indicating whether both paths name the same file.
+func sameFile(a, b string) bool {
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bi, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+
+	return os.SameFile(ai, bi)
+}
+
+// Add records the type and method declarations of a file.
+func (p *pkg) add(f *ast.File) {
+	p.name = f.Name.Name
+
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				if spec, ok := spec.(*ast.TypeSpec); ok {
+					p.types[spec.Name.Name] = spec
+				}
+			}
+		case *ast.FuncDecl:
+			if decl.Recv != nil && len(decl.Recv.List) == 1 {
+				recv := decl.Recv.List[0].Type
+				if star, ok := recv.(*ast.StarExpr); ok {
+					recv = star.X
+				}
+				if ident, ok := recv.(*ast.Ident); ok {
+					p.methods[ident.Name] = append(p.methods[ident.Name], decl)
+				}
+			}
+		}
+	}
+}
+
+// Lookup returns the named type declared in the package, or nil if there is none.
+func (p *pkg) lookup(name string) *goType {
+	if _, ok := p.types[name]; !ok {
+		return nil
+	}
+
+	return p.typeOf(ast.NewIdent(name))
+}
+
+// TypeOf describes the type written as expr. Types from other packages, interfaces, generics
+// and structs with embedded fields are dynamic, so they are looked up at runtime.
+func (p *pkg) typeOf(expr ast.Expr) *goType {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		if t, ok := p.parsed[expr.Name]; ok {
+			return t
+		}
+		if spec, ok := p.types[expr.Name]; ok {
+			return p.named(spec)
+		}
+		if basic := basicType(expr.Name); basic != "" {
+			return &goType{kind: basicKind, expr: expr.Name, basic: basic}
+		}
+		if expr.Name == "any" || expr.Name == "error" {
+			return dynamic
+		}
+	case *ast.InterfaceType:
+		return dynamic
+	case *ast.ParenExpr:
+		return p.typeOf(expr.X)
+	case *ast.StarExpr:
+		elem := p.typeOf(expr.X)
+		if elem.kind == dynamicKind || elem.kind == pointerKind {
+			return opaque
+		}
+		return &goType{kind: pointerKind, expr: "*" + elem.expr, elem: elem}
+	case *ast.ArrayType:
+		elem := p.typeOf(expr.Elt)
+		if isOpaque(elem) {
+			return opaque
+		}
+		if expr.Len == nil {
+			return &goType{kind: sliceKind, expr: "[]" + elem.expr, elem: elem}
+		}
+		return &goType{kind: arrayKind, expr: types.ExprString(expr), elem: elem}
+	case *ast.MapType:
+		key, elem := p.typeOf(expr.Key), p.typeOf(expr.Value)
+		if key.kind == dynamicKind || isOpaque(elem) {
+			return opaque
+		}
+		return &goType{kind: mapKind, expr: "map[" + key.expr + "]" + elem.expr, key: key, elem: elem}
+	case *ast.FuncType:
+		switch s := types.ExprString(expr); s {
+		case "func() string", "func(string) string", "func(string, func(string) string) string":
+			return &goType{kind: funcKind, expr: s}
+		}
+	}
+
+	return opaque
+}
+
+// IsOpaque returns a boolean indicating whether the type can not be named in generated code.
+func isOpaque(t *goType) bool {
+	return t.kind == dynamicKind && t != dynamic
+}
+
+// Named describes a type declared in the package, along with its methods.
+func (p *pkg) named(spec *ast.TypeSpec) *goType {
+	name := spec.Name.Name
+	if spec.TypeParams != nil {
+		p.parsed[name] = opaque
+		return opaque
+	}
+	if spec.Assign.IsValid() {
+		// an alias is the type it names
+		p.parsed[name] = opaque
+		t := p.typeOf(spec.Type)
+		p.parsed[name] = t
+		return t
+	}
+
+	// recorded before the fields are parsed, so that recursive types refer to themselves
+	t := &goType{expr: name, named: true, methods: make(map[string]method), ptrMethods: make(map[string]method)}
+	p.parsed[name] = t
+
+	switch underlying := spec.Type.(type) {
+	case *ast.StructType:
+		t.kind = structKind
+		if !p.structFields(t, underlying) {
+			*t = *opaque
+			return t
+		}
+	default:
+		u := p.typeOf(underlying)
+		if u.kind == dynamicKind || u.kind == pointerKind || u.kind == funcKind {
+			*t = *opaque
+			return t
+		}
+		// the fields, but not the methods, of the underlying type
+		t.kind, t.basic, t.elem, t.key = u.kind, u.basic, u.elem, u.key
+		t.fields, t.fieldNames = u.fields, u.fieldNames
+	}
+
+	for _, decl := range p.methods[name] {
+		if !decl.Name.IsExported() || decl.Type.TypeParams != nil {
+			continue
+		}
+		if decl.Type.Params.NumFields() == 0 && (decl.Name.Name == "String" || decl.Name.Name == "Error") {
+			if _, ptr := decl.Recv.List[0].Type.(*ast.StarExpr); !ptr {
+				t.stringer = true
+			}
+		}
+		m, ok := p.method(decl)
+		if !ok {
+			continue
+		}
+		if _, ptr := decl.Recv.List[0].Type.(*ast.StarExpr); ptr {
+			t.ptrMethods[decl.Name.Name] = m
+		} else {
+			t.methods[decl.Name.Name] = m
+		}
+	}
+
+	return t
+}
+
+// StructFields records the fields of a struct by the names they can be looked up with,
+// the same way as the package does. Structs with embedded fields are not supported.
+func (p *pkg) structFields(t *goType, s *ast.StructType) bool {
+	byName := make(map[string]string)
+	byJSON := make(map[string]string)
+	byTag := make(map[string]string)
+	fieldTypes := make(map[string]*goType)
+
+	for _, f := range s.Fields.List {
+		if len(f.Names) == 0 {
+			return false
+		}
+
+		var tag reflect.StructTag
+		if f.Tag != nil {
+			s, _ := strconv.Unquote(f.Tag.Value)
+			tag = reflect.StructTag(s)
+		}
+		mustacheName, mustacheSkip := tagName(tag.Get("mustache"))
+		jsonName, jsonSkip := tagName(tag.Get("json"))
+
+		for _, name := range f.Names {
+			if !name.IsExported() || mustacheSkip || (jsonSkip && mustacheName == "") {
+				continue
+			}
+			fieldTypes[name.Name] = p.typeOf(f.Type)
+
+			byName[name.Name] = name.Name
+			if _, ok := byJSON[jsonName]; !ok && jsonName != "" && mustacheName == "" {
+				byJSON[jsonName] = name.Name
+			}
+			if _, ok := byTag[mustacheName]; !ok && mustacheName != "" {
+				byTag[mustacheName] = name.Name
+			}
+		}
+	}
+
+	for name, field := range byJSON {
+		byName[name] = field
+	}
+	for name, field := range byTag {
+		byName[name] = field
+	}
+
+	t.fields = make(map[string]*goType)
+	t.fieldNames = byName
+	for name, field := range byName {
+		t.fields[name] = fieldTypes[field]
+	}
+
+	return true
+}
+
+// Method describes a method that takes no arguments and returns a value, or a value and an error.
+func (p *pkg) method(decl *ast.FuncDecl) (method, bool) {
+	if decl.Type.Params.NumFields() != 0 || decl.Type.Results == nil {
+		return method{}, false
+	}
+
+	var results []ast.Expr
+	for _, field := range decl.Type.Results.List {
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			results = append(results, field.Type)
+		}
+	}
+
+	switch {
+	case len(results) == 1:
+		return method{typ: p.typeOf(results[0])}, true
+	case len(results) == 2 && types.ExprString(results[1]) == "error":
+		return method{typ: p.typeOf(results[0]), err: true}, true
+	}
+
+	return method{}, false
+}
+
+// BasicType returns the builtin type named, or an empty string if it is not a string, number or boolean.
+func basicType(name string) string {
+	switch name {
+	case "string", "bool", "int", "int8", "int16", "int32", "int64",
+		"uint", "uint8", "uint16", "uint32", "uint64", "uintptr", "float32", "float64", "complex64", "complex128":
+		return name
+	case "byte":
+		return "uint8"
+	case "rune":
+		return "int32"
+	}
+
+	return ""
+}
+
+// TagName parses a struct tag value such as "name,omitempty" and returns the name
+// and whether the field should be skipped, which is indicated by a tag of "-".
+func tagName(tag string) (string, bool) {
+	if tag == "-" {
+		return "", true
+	}
+	if i := strings.Index(tag, ","); i >= 0 {
+		tag = tag[:i]
+	}
+
+	return tag, false
+}
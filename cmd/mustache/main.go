@@ -0,0 +1,184 @@
+// Mustache renders a mustache template from the command line.
+//
+//	mustache [flags] [template]
+//
+// The template is read from the file named, or from stdin if there is none or it is -. The data is read
+// from the file named by -data, as JSON if it ends with .json and as YAML otherwise, and from the
+// environment with -env. Names in the data file take precedence over environment variables.
+//
+//	mustache -data config.yaml -escape none nginx.conf.mustache > nginx.conf
+//	FOO=bar mustache -env -o out.txt template.mustache
+//
+// Partials are read from -partials-dir, by default the directory of the template. With -strict,
+// names that are not found in the data are errors. Nothing is written if there are errors,
+// which are reported with the name, line and column of the offending tag.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	mustache "github.com/smarden1/mustache.go"
+	"gopkg.in/yaml.v3"
+)
+
+// escapers are the escape functions that can be chosen with -escape.
+var escapers = map[string]func(string) string{
+	"html": mustache.EscapeHTML,
+	"none": mustache.EscapeNone,
+	"json": mustache.EscapeJSON,
+	"js":   mustache.EscapeJS,
+	"url":  mustache.EscapeURL,
+}
+
+// errUsage reports that the command was called incorrectly, the flag package has already said why.
+var errUsage = errors.New("usage")
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr, os.Environ()); err != nil {
+		if err == errUsage {
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "mustache: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// Run renders the template named by the arguments.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer, environ []string) error {
+	flags := flag.NewFlagSet("mustache", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: mustache [flags] [template]\n")
+		flags.PrintDefaults()
+	}
+	dataPath := flags.String("data", "", "a JSON or YAML file holding the data, - for stdin")
+	env := flags.Bool("env", false, "use environment variables as data")
+	partialsDir := flags.String("partials-dir", "", "the directory partials are read from, the directory of the template by default")
+	strict := flags.Bool("strict", false, "report names that are not found in the data as errors")
+	escape := flags.String("escape", "html", "how interpolated values are escaped, one of html, none, json, js or url")
+	output := flags.String("o", "", "the file to write the output to, stdout by default")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return errUsage
+	}
+	escapeFn, ok := escapers[*escape]
+	if !ok {
+		return fmt.Errorf("unknown escape %s, use one of html, none, json, js or url", *escape)
+	}
+
+	templatePath := flags.Arg(0)
+	if templatePath == "-" {
+		templatePath = ""
+	}
+	if templatePath == "" && *dataPath == "-" {
+		return errors.New("the template and the data can not both be read from stdin")
+	}
+
+	src, err := readFile(templatePath, stdin)
+	if err != nil {
+		return err
+	}
+
+	var data []interface{}
+	if *env {
+		data = append(data, environment(environ))
+	}
+	if *dataPath != "" {
+		d, err := readData(*dataPath, stdin)
+		if err != nil {
+			return err
+		}
+		data = append(data, d)
+	}
+
+	name := "stdin"
+	dir := "."
+	if templatePath != "" {
+		name = strings.TrimSuffix(filepath.Base(templatePath), filepath.Ext(templatePath))
+		dir = filepath.Dir(templatePath)
+	}
+	if *partialsDir != "" {
+		dir = *partialsDir
+	}
+
+	opts := []mustache.Option{mustache.Name(name), mustache.Partials(mustache.DirLoader(dir)), mustache.Escape(escapeFn)}
+	if *strict {
+		opts = append(opts, mustache.MissingKeys(mustache.ReportMissingKeys))
+	}
+	tmpl, err := mustache.Compile(src, opts...)
+	if err != nil {
+		return err
+	}
+
+	// rendered in full before writing, so that nothing is written if it fails
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data...); err != nil {
+		return err
+	}
+	if *output != "" {
+		return os.WriteFile(*output, b.Bytes(), 0666)
+	}
+	_, err = stdout.Write(b.Bytes())
+
+	return err
+}
+
+// ReadFile reads the file at path, or stdin if the path is empty or -.
+func readFile(path string, stdin io.Reader) (string, error) {
+	var b []byte
+	var err error
+	if path == "" || path == "-" {
+		b, err = io.ReadAll(stdin)
+	} else {
+		b, err = os.ReadFile(path)
+	}
+
+	return string(b), err
+}
+
+// ReadData reads the data from a file, as JSON if its name ends with .json and as YAML otherwise.
+// Numbers in JSON are kept as written.
+func readData(path string, stdin io.Reader) (interface{}, error) {
+	src, err := readFile(path, stdin)
+	if err != nil {
+		return nil, err
+	}
+
+	var data interface{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		d := json.NewDecoder(strings.NewReader(src))
+		d.UseNumber()
+		err = d.Decode(&data)
+	} else {
+		err = yaml.Unmarshal([]byte(src), &data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return data, nil
+}
+
+// Environment returns the environment variables by name.
+func environment(environ []string) map[string]string {
+	env := make(map[string]string, len(environ))
+	for _, kv := range environ {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			env[k] = v
+		}
+	}
+
+	return env
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"config.mustache":        "host={{host}} port={{port}} user={{USER}}\n{{#paths}}{{> path}}{{/paths}}",
+		"path.mustache":          "path={{.}}\n",
+		"partials/path.mustache": "other={{.}}\n",
+		"html.mustache":          "{{name}}",
+		"broken.mustache":        "line\n  {{#open}}",
+		"data.json":              `{"host": "example.com", "port": 8080, "paths": ["/a", "/b"], "name": "<b>"}`,
+		"data.yaml":              "host: example.com\nport: 8080\npaths:\n  - /a\n  - /b\n",
+		"bad.yaml":               "host: [",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0777)
+		if err := os.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+	environ := []string{"USER=steve", "host=ignored"}
+
+	type expects struct {
+		args     []string
+		stdin    string
+		expected string
+		err      string
+	}
+
+	tests := []expects{
+		{[]string{"-data", path("data.json"), "-env", path("config.mustache")}, "", "host=example.com port=8080 user=steve\npath=/a\npath=/b\n", ""},
+		{[]string{"--data", path("data.yaml"), "--partials-dir", path("partials"), path("config.mustache")}, "", "host=example.com port=8080 user=\nother=/a\nother=/b\n", ""},
+		{[]string{"-data", "-", path("html.mustache")}, `{"name": "<b>"}`, "&lt;b&gt;", ""},
+		{[]string{"-data", path("data.json"), "--escape=none", path("html.mustache")}, "", "<b>", ""},
+		{[]string{"-env"}, "{{USER}}", "steve", ""},
+		{[]string{"-env", "-"}, "{{USER}}", "steve", ""},
+		{[]string{"-strict", "-env"}, "{{USER}} {{HOME}} {{#SHELL}}{{/SHELL}}", "", "stdin:1:10: Render error: HOME was not found for {{HOME}}\nstdin:1:19: Render error: SHELL was not found for {{#SHELL}}"},
+		{[]string{path("broken.mustache")}, "", "", "broken:2:3: Malformed template: open was not closed"},
+		{[]string{"-data", path("bad.yaml"), path("html.mustache")}, "", "", path("bad.yaml") + ": yaml: line 1: did not find expected node content"},
+		{[]string{"-data", "-"}, "", "", "the template and the data can not both be read from stdin"},
+		{[]string{"-escape", "xml"}, "", "", "unknown escape xml, use one of html, none, json, js or url"},
+		{[]string{"-nope"}, "", "", "usage"},
+		{[]string{"a", "b"}, "", "", "usage"},
+	}
+
+	for _, test := range tests {
+		var stdout, stderr bytes.Buffer
+		err := run(test.args, strings.NewReader(test.stdin), &stdout, &stderr, environ)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%v expected error %q, but got %v", test.args, test.err, err)
+			}
+			if stdout.Len() != 0 {
+				t.Errorf("%v expected no output, but got %q", test.args, stdout.String())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v unexpected error, %s", test.args, err)
+		} else if stdout.String() != test.expected {
+			t.Errorf("%v expected %q, but got %q", test.args, test.expected, stdout.String())
+		}
+	}
+}
+
+func TestRunOutput(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "out.txt")
+
+	var stdout, stderr bytes.Buffer
+	if err := run([]string{"-env", "-o", output}, strings.NewReader("hi {{USER}}"), &stdout, &stderr, []string{"USER=steve"}); err != nil {
+		t.Fatalf("Unexpected error, %s", err)
+	}
+	if b, err := os.ReadFile(output); err != nil || string(b) != "hi steve" {
+		t.Errorf("Expected the output to be written to the file, got %q %v", b, err)
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("Expected nothing on stdout, but got %q", stdout.String())
+	}
+}
@@ -0,0 +1,126 @@
+package mustache
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ErrorKind describes what is wrong with a template.
+type ErrorKind int
+
+const (
+	UnclosedSection ErrorKind = iota + 1 // a section was opened but never closed
+	MismatchedClose                      // a section was closed that was not the innermost open section
+	UnclosedTag                          // a tag was opened but the template ended before it was closed
+	BadDelimiter                         // a set delimiter tag does not contain exactly two delimiters
+	MissingPartial                       // a partial could not be loaded
+	UnknownFilter                        // a filter was used that has not been registered
+)
+
+// String returns a short description of the kind of error.
+func (k ErrorKind) String() string {
+	switch k {
+	case UnclosedSection:
+		return "unclosed section"
+	case MismatchedClose:
+		return "mismatched close"
+	case UnclosedTag:
+		return "unclosed tag"
+	case BadDelimiter:
+		return "bad delimiter"
+	case MissingPartial:
+		return "missing partial"
+	case UnknownFilter:
+		return "unknown filter"
+	}
+
+	return fmt.Sprintf("ErrorKind(%d)", int(k))
+}
+
+// ParseError describes a malformed template and where the problem was found.
+type ParseError struct {
+	Name   string    // name of the template, empty if it was not named
+	Line   int       // line of the offending tag, starting at 1
+	Column int       // column of the offending tag in characters, starting at 1
+	Tag    string    // the offending tag as written in the template
+	Kind   ErrorKind // the kind of error
+	Msg    string    // description of the error
+	Err    error     // the underlying error, if any, such as an error from a PartialLoader
+}
+
+// Error returns the error prefixed with its position, i.e. - layout:3:7: Malformed template: ...
+func (e *ParseError) Error() string {
+	s := fmt.Sprintf("%s Malformed template: %s", position(e.Name, e.Line, e.Column), e.Msg)
+	if e.Err != nil {
+		s += ": " + e.Err.Error()
+	}
+
+	return s
+}
+
+// Unwrap returns the underlying error.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Position formats a position in a template for an error message, i.e. - name:line:column:
+func position(name string, line, col int) string {
+	if name == "" {
+		return fmt.Sprintf("%d:%d:", line, col)
+	}
+
+	return fmt.Sprintf("%s:%d:%d:", name, line, col)
+}
+
+// Cursor tracks the line and column of an index in a template as it is scanned forwards.
+type cursor struct {
+	template  string
+	i         int // index the line and column have been counted up to
+	line, col int
+}
+
+// Position returns the line and column of the index. Counting continues from the index
+// of the previous call, unless the index is before it.
+func (c *cursor) position(i int) (int, int) {
+	if i < c.i {
+		c.i, c.line, c.col = 0, 1, 1
+	}
+	for ; c.i < i && c.i < len(c.template); c.i++ {
+		if c.template[c.i] == '\n' {
+			c.line++
+			c.col = 1
+		} else if c.template[c.i]&0xC0 != 0x80 {
+			// only count the first byte of each utf-8 character
+			c.col++
+		}
+	}
+
+	return c.line, c.col
+}
+
+// MissingKeyError describes a name in the template that could not be found in the context.
+type MissingKeyError struct {
+	Name   string // name of the template, empty if it was not named
+	Key    string // the name that could not be found
+	Line   int    // line of the tag, starting at 1
+	Column int    // column of the tag in characters, starting at 1
+	Tag    string // the tag as written in the template
+}
+
+// Error returns the error prefixed with its position, i.e. - email:3:7: Render error: ...
+func (e *MissingKeyError) Error() string {
+	return fmt.Sprintf("%s Render error: %s was not found for %s", position(e.Name, e.Line, e.Column), e.Key, e.Tag)
+}
+
+// MissingKeysError reports every name that could not be found while rendering a template.
+type MissingKeysError []*MissingKeyError
+
+// Error returns all of the missing keys, one per line.
+func (e MissingKeysError) Error() string {
+	lines := make([]string, len(e))
+	for i, missing := range e {
+		lines[i] = missing.Error()
+	}
+
+	return strings.Join(lines, "\n")
+}
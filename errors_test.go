@@ -0,0 +1,105 @@
+package mustache
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestParseError(t *testing.T) {
+	type expects struct {
+		template string
+		kind     ErrorKind
+		line     int
+		col      int
+		tag      string
+		message  string
+	}
+
+	e := [...]expects{
+		expects{"hello\n  {{#name}}{{foo}}", UnclosedSection, 2, 3, "{{#name}}", "page:2:3: Malformed template: name was not closed"},
+		expects{"{{foo}}\n{{/name}}", MismatchedClose, 2, 1, "{{/name}}", "page:2:1: Malformed template: name was closed but not opened"},
+		expects{"{{#a}}\n{{#b}}\n  {{/a}}{{/b}}", MismatchedClose, 3, 3, "{{/a}}", "page:3:3: Malformed template: a was closed but b is open"},
+		expects{"héllo {{=<% =}}", BadDelimiter, 1, 7, "{{=<% =}}", `page:1:7: Malformed template: delimiters "<% " should be an opening and closing tag separated by a space`},
+		expects{"hello {{name", UnclosedTag, 1, 7, "{{name", "page:1:7: Malformed template: {{name was not closed"},
+		expects{"{{/a}}{{#b}}", MismatchedClose, 1, 1, "{{/a}}", "page:1:1: Malformed template: a was closed but not opened"},
+	}
+
+	for _, ex := range e {
+		_, err := Compile(ex.template, Name("page"))
+
+		var perr *ParseError
+		if !errors.As(err, &perr) {
+			t.Errorf("Expected a parse error for %q, got %v", ex.template, err)
+			continue
+		}
+		if perr.Kind != ex.kind || perr.Line != ex.line || perr.Column != ex.col || perr.Tag != ex.tag || perr.Name != "page" {
+			t.Errorf("Incorrect parse error for %q, got %s at %d:%d in %s", ex.template, perr.Kind, perr.Line, perr.Column, perr.Tag)
+		}
+		if err.Error() != ex.message {
+			t.Errorf("Incorrect error message for %q, got %s, expected %s", ex.template, err.Error(), ex.message)
+		}
+	}
+}
+
+type failingLoader struct{}
+
+func (failingLoader) Load(name string) (string, error) {
+	return "", errors.New("permission denied")
+}
+
+func TestParseErrorPartials(t *testing.T) {
+	template, _ := Compile("a\n {{> broken}}", Name("page"), Partials(MapLoader{"broken": "{{#open}}"}))
+
+	var perr *ParseError
+	if err := template.Execute(&failingWriter{n: 10}, map[string]string{}); !errors.As(err, &perr) || perr.Name != "broken" || perr.Kind != UnclosedSection {
+		t.Errorf("Expected the parse error of the partial, got %v", err)
+	}
+
+	template, _ = Compile("a\n {{> broken}}", Name("page"), Partials(failingLoader{}))
+
+	err := template.Execute(&failingWriter{n: 10}, map[string]string{})
+	if !errors.As(err, &perr) || perr.Name != "page" || perr.Kind != MissingPartial || perr.Line != 2 || perr.Column != 2 {
+		t.Errorf("Expected a missing partial error, got %v", err)
+	}
+	if err.Error() != "page:2:2: Malformed template: partial broken could not be loaded: permission denied" {
+		t.Errorf("Incorrect error message, got %s", err)
+	}
+}
+
+func TestMissingKeys(t *testing.T) {
+	data := map[string]interface{}{"name": "steve", "list": []string{"a"}}
+	src := "{{name}}\n{{#list}}{{.}} {{custmer_name}}{{/list}}{{^nope}}!{{/nope}}{{#gone}}x{{/gone}}"
+
+	template, _ := Compile(src, Name("email"))
+	if r := template.Render(data); r != "steve\na !" {
+		t.Errorf("Incorrect rendered template, got %q", r)
+	}
+
+	template, _ = Compile(src, Name("email"), MissingKeys(ErrorOnMissingKeys))
+	var b bytes.Buffer
+	err := template.Execute(&b, data)
+
+	var missing *MissingKeyError
+	if !errors.As(err, &missing) || missing.Key != "custmer_name" || missing.Line != 2 || missing.Column != 16 {
+		t.Errorf("Expected a missing key error for custmer_name, got %v", err)
+	}
+	if err.Error() != "email:2:16: Render error: custmer_name was not found for {{custmer_name}}" {
+		t.Errorf("Incorrect error message, got %s", err)
+	}
+	if b.String() != "steve\na " {
+		t.Errorf("Expected rendering to stop at the missing key, got %q", b.String())
+	}
+
+	template, _ = Compile(src, Name("email"), MissingKeys(ReportMissingKeys))
+	b.Reset()
+	err = template.Execute(&b, data)
+
+	var report MissingKeysError
+	if !errors.As(err, &report) || len(report) != 2 || report[0].Key != "custmer_name" || report[1].Key != "gone" {
+		t.Errorf("Expected a report of the missing keys, got %v", err)
+	}
+	if b.String() != "steve\na !" {
+		t.Errorf("Expected the template to be rendered, got %q", b.String())
+	}
+}
@@ -0,0 +1,47 @@
+package mustache
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"text/template"
+)
+
+var htmlReplacer = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	`"`, "&quot;",
+	"'", "&#39;",
+)
+
+// EscapeHTML escapes &, <, >, " and ' so that the value is safe within html
+// elements and quoted attributes. This is the default escaper.
+func EscapeHTML(s string) string {
+	return htmlReplacer.Replace(s)
+}
+
+// EscapeJSON escapes the value for use within a json string, the quotes are not included.
+// <, > and & are escaped as unicode so the value is also safe within html.
+func EscapeJSON(s string) string {
+	b, _ := json.Marshal(s)
+
+	return string(b[1 : len(b)-1])
+}
+
+// EscapeURL escapes the value for use as a query parameter in a url.
+func EscapeURL(s string) string {
+	return url.QueryEscape(s)
+}
+
+// EscapeJS escapes the value for use within a quoted javascript string,
+// including within a <script> element.
+func EscapeJS(s string) string {
+	return template.JSEscapeString(s)
+}
+
+// EscapeNone returns the value unchanged, for templates that are not html such as
+// plain text emails or configuration files.
+func EscapeNone(s string) string {
+	return s
+}
@@ -0,0 +1,48 @@
+package mustache
+
+import "testing"
+
+func TestEscapers(t *testing.T) {
+	type expects struct {
+		desc     string
+		escaper  func(string) string
+		expected string
+	}
+
+	value := `<a href="x?a=1&b=2">it's</a>`
+	e := [...]expects{
+		expects{"html", EscapeHTML, "&lt;a href=&quot;x?a=1&amp;b=2&quot;&gt;it&#39;s&lt;/a&gt;"},
+		expects{"json", EscapeJSON, `\u003ca href=\"x?a=1\u0026b=2\"\u003eit's\u003c/a\u003e`},
+		expects{"url", EscapeURL, "%3Ca+href%3D%22x%3Fa%3D1%26b%3D2%22%3Eit%27s%3C%2Fa%3E"},
+		expects{"js", EscapeJS, `\u003Ca href\u003D\"x?a\u003D1\u0026b\u003D2\"\u003Eit\'s\u003C/a\u003E`},
+		expects{"none", EscapeNone, value},
+	}
+
+	for _, ex := range e {
+		if s := ex.escaper(value); s != ex.expected {
+			t.Errorf("Incorrect %s escaping, got %s, expected %s", ex.desc, s, ex.expected)
+		}
+
+		template, _ := Compile("{{v}}|{{{v}}}|{{&v}}", Escape(ex.escaper))
+		if r := template.Render(map[string]string{"v": value}); r != ex.expected+"|"+value+"|"+value {
+			t.Errorf("Incorrect rendered template with %s escaping, got %s", ex.desc, r)
+		}
+	}
+}
+
+func TestEscapeNil(t *testing.T) {
+	template, err := Compile("{{v}}", Escape(nil))
+	if err != nil {
+		t.Fatalf("Unexpected error while compiling, %s", err)
+	}
+	if r, err := render(template, map[string]string{"v": "<b>"}); err != nil || r != "&lt;b&gt;" {
+		t.Errorf("Expected a nil escaper to escape html, got %s and %v", r, err)
+	}
+}
+
+func TestEscapeHTMLSpec(t *testing.T) {
+	r, _ := Render("These characters should be HTML escaped: {{forbidden}}\n", map[string]string{"forbidden": `& " < >`})
+	if expected := "These characters should be HTML escaped: &amp; &quot; &lt; &gt;\n"; r != expected {
+		t.Errorf("Incorrect rendered template, got %q, expected %q", r, expected)
+	}
+}
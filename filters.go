@@ -0,0 +1,87 @@
+package mustache
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// FuncMap maps the names of filters to functions. Each function must take a single argument
+// and return a single value, or a value and an error, i.e. - "upper": strings.ToUpper
+type FuncMap map[string]interface{}
+
+// Validate returns an error if any of the functions can not be used as a filter.
+func (m FuncMap) validate() error {
+	for name, fn := range m {
+		t := reflect.TypeOf(fn)
+		if t == nil || t.Kind() != reflect.Func || t.NumIn() != 1 || t.NumOut() == 0 || t.NumOut() > 2 || (t.NumOut() == 2 && !t.Out(1).Implements(errorType)) {
+			return fmt.Errorf("Filter error: %s should take one argument and return a value or a value and an error", name)
+		}
+	}
+
+	return nil
+}
+
+// ParseFilters walks the tokens and splits the args of each interpolation into the name
+// to look up and the filters to apply to it. Filters that are not in funcs are reported as a *ParseError.
+func parseFilters(name string, t *token, funcs FuncMap) error {
+	if t.within && t.cmd == "" && strings.Contains(t.args, "|") {
+		pipeline := strings.Split(t.args, "|")
+		t.args, t.filters = pipeline[0], pipeline[1:]
+
+		for _, filter := range t.filters {
+			if _, ok := funcs[filter]; !ok {
+				return &ParseError{Name: name, Line: t.line, Column: t.col, Tag: t.tag, Kind: UnknownFilter, Msg: fmt.Sprintf("%s is not a registered filter", filter)}
+			}
+		}
+	}
+
+	for _, child := range t.children {
+		if err := parseFilters(name, child, funcs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ApplyFilters passes the value through each of the filters of the token in order.
+func (r *renderer) applyFilters(t *token, val interface{}) (interface{}, error) {
+	for _, filter := range t.filters {
+		fn := reflect.ValueOf(r.template.filters[filter])
+		in := fn.Type().In(0)
+
+		var arg reflect.Value
+		if val == nil {
+			arg = reflect.Zero(in)
+		} else if arg = reflect.ValueOf(val); !arg.Type().AssignableTo(in) && canConvert(arg.Type(), in) {
+			arg = arg.Convert(in)
+		} else if !arg.Type().AssignableTo(in) {
+			return nil, fmt.Errorf("%s Render error: filter %s can not be applied to %T for %s", position(r.name, t.line, t.col), filter, val, t.tag)
+		}
+
+		out := fn.Call([]reflect.Value{arg})
+		if len(out) == 2 && !out[1].IsNil() {
+			return nil, fmt.Errorf("%s Render error: filter %s returned an error for %s: %w", position(r.name, t.line, t.col), filter, t.tag, out[1].Interface().(error))
+		}
+		val = out[0].Interface()
+	}
+
+	return val, nil
+}
+
+// CanConvert returns a boolean indicating if a value can be converted to the argument type of a filter.
+// Only conversions between types of the same kind, such as named strings, or between numbers are
+// allowed, so that numbers are not converted to strings as runes.
+func canConvert(from, to reflect.Type) bool {
+	if !from.ConvertibleTo(to) {
+		return false
+	}
+
+	return from.Kind() == to.Kind() || (isNumber(from.Kind()) && isNumber(to.Kind()))
+}
+
+// IsNumber returns a boolean indicating if the kind is an integer or floating point number.
+func isNumber(k reflect.Kind) bool {
+	return (k >= reflect.Int && k <= reflect.Uintptr) || k == reflect.Float32 || k == reflect.Float64
+}
@@ -0,0 +1,82 @@
+package mustache
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type cents int
+
+func TestFilters(t *testing.T) {
+	funcs := FuncMap{
+		"upper":    strings.ToUpper,
+		"currency": func(f float64) string { return fmt.Sprintf("$%.2f", f) },
+		"double":   func(n int) int { return n * 2 },
+		"fail":     func(interface{}) (string, error) { return "", errors.New("failed") },
+	}
+
+	data := map[string]interface{}{
+		"name":  "steve & co",
+		"price": 3,
+		"cents": cents(4),
+		"user":  map[string]string{"name": "stove"},
+	}
+
+	type expects struct {
+		template string
+		expected string
+	}
+
+	e := [...]expects{
+		expects{"{{ name | upper }}", "STEVE &amp; CO"},
+		expects{"{{{ name|upper }}}", "STEVE & CO"},
+		expects{"{{ price | double | currency }}", "$6.00"},
+		expects{"{{ cents | double }}", "8"},
+		expects{"{{ user.name | upper }}", "STOVE"},
+		expects{"{{ missing | upper }}", ""},
+	}
+
+	for _, ex := range e {
+		template, err := Compile(ex.template, Filters(funcs))
+		if err != nil {
+			t.Errorf("Unexpected error compiling %s, %s", ex.template, err)
+			continue
+		}
+		if r, err := render(template, data); r != ex.expected || err != nil {
+			t.Errorf("Incorrect rendered template for %s, got %s and %v, expected %s", ex.template, r, err, ex.expected)
+		}
+	}
+
+	errs := [...]string{"{{ name | fail }}", "{{ name | double }}"}
+	for _, src := range errs {
+		template, _ := Compile(src, Filters(funcs))
+		if _, err := render(template, data); err == nil {
+			t.Errorf("Expected an error rendering %s", src)
+		}
+	}
+}
+
+func TestFiltersUnknown(t *testing.T) {
+	_, err := Compile("hi\n{{#a}} {{ name | lower }}{{/a}}", Name("page"), Filters(FuncMap{"upper": strings.ToUpper}))
+
+	var perr *ParseError
+	if !errors.As(err, &perr) || perr.Kind != UnknownFilter || perr.Line != 2 || perr.Column != 8 {
+		t.Errorf("Expected an unknown filter error, got %v", err)
+	}
+
+	template, _ := Compile("{{>p}}", Filters(FuncMap{}), Partials(MapLoader{"p": "{{ x | nope }}"}))
+	if _, err := render(template, nil); !errors.As(err, &perr) || perr.Kind != UnknownFilter || perr.Name != "p" {
+		t.Errorf("Expected an unknown filter error from the partial, got %v", err)
+	}
+
+	if template, err := Compile("{{a}}", Filters(FuncMap{"bad": func(a, b string) string { return a }})); err == nil || template != nil {
+		t.Errorf("Expected an error and no template for a function that can not be a filter, got %v and %v", template, err)
+	}
+
+	// without filters the pipe is part of the name
+	if r, _ := Render("{{a|b}}", map[string]string{"a|b": "c"}); r != "c" {
+		t.Errorf("Expected pipes to be ignored without filters, got %s", r)
+	}
+}
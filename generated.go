@@ -0,0 +1,72 @@
+package mustache
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/smarden1/mustache.go/internal/hooks"
+)
+
+// The functions in this file are used by code generated by mustache-gen, through the genrt package,
+// for the values whose types are not known when the code is generated. They behave exactly as rendering
+// a template compiled with the default options does, so the generated code renders the same output.
+
+func init() {
+	hooks.Lookup = contextStackContains
+	hooks.LookupKey = lookupKey
+	hooks.Truthy = func(val interface{}) bool { return !isFalsey(val) }
+	hooks.IsLambda = isLambda
+	hooks.Items = generatedItems
+	hooks.Format = generatedFormat
+	hooks.Interpolate = generatedInterpolate
+	hooks.RenderLambda = generatedRenderLambda
+	hooks.Reindent = func(w io.Writer, strip, add string) io.Writer { return &indentWriter{w: w, strip: strip, add: add} }
+}
+
+// generatedTemplate holds the default options used to render lambdas from generated code.
+var generatedTemplate = &Template{partials: DirLoader(""), escape: EscapeHTML}
+
+// GeneratedItems returns the contexts that a section over the value renders its content with, each
+// item of an array or slice, otherwise the value itself.
+func generatedItems(val interface{}) []interface{} {
+	v := indirect(reflect.ValueOf(val))
+	if v.Kind() != reflect.Array && v.Kind() != reflect.Slice {
+		return []interface{}{val}
+	}
+
+	items := make([]interface{}, v.Len())
+	for i := range items {
+		items[i] = valueInterface(v.Index(i))
+	}
+
+	return items
+}
+
+// GeneratedFormat returns the text an interpolation writes for a value that is not a lambda, before it is escaped.
+func generatedFormat(val interface{}) string {
+	if isNil(val) {
+		return ""
+	}
+
+	return fmt.Sprint(val)
+}
+
+// GeneratedInterpolate returns the text an interpolation writes for a value, before it is escaped.
+// Lambdas are called and their result rendered with the context stack.
+func generatedInterpolate(cstack []interface{}, val interface{}) (string, error) {
+	if fn, ok := val.(func() string); ok {
+		r := &renderer{template: generatedTemplate, missing: &MissingKeysError{}}
+		return r.renderString(fn(), defaultOtag, defaultCtag, cstack)
+	}
+
+	return generatedFormat(val), nil
+}
+
+// GeneratedRenderLambda renders a section lambda with the raw text of the section, which was written with the given delimiters.
+func generatedRenderLambda(w io.Writer, cstack []interface{}, fn interface{}, text, otag, ctag string) error {
+	r := &renderer{template: generatedTemplate, w: w, missing: &MissingKeysError{}}
+	t := &token{cmd: "#", within: true, text: text, otag: otag, ctag: ctag}
+
+	return r.renderSectionLambda(t, fn, cstack)
+}
@@ -0,0 +1,63 @@
+// Package genrt is the runtime support for code generated by mustache-gen, which calls it for the
+// values whose types are not known when the code is generated. Each function behaves exactly as
+// rendering a template compiled with the default options does.
+//
+// The package is only meant to be used by generated code. Its API follows the needs of mustache-gen
+// and may change in any release, so code should be regenerated after upgrading rather than call it directly.
+package genrt
+
+import (
+	"io"
+
+	// the mustache package sets the hooks when it is initialized
+	_ "github.com/smarden1/mustache.go"
+	"github.com/smarden1/mustache.go/internal/hooks"
+)
+
+// Lookup finds a name, which may be dotted, in the context stack as a template would.
+func Lookup(cstack []interface{}, name string) (interface{}, bool, error) {
+	return hooks.Lookup(cstack, name)
+}
+
+// LookupKey finds a single key, without any dots, in a context value as a template would.
+func LookupKey(c interface{}, key string) (interface{}, bool, error) {
+	return hooks.LookupKey(c, key)
+}
+
+// Truthy returns a boolean indicating whether a section would be rendered for the value.
+func Truthy(val interface{}) bool {
+	return hooks.Truthy(val)
+}
+
+// IsLambda returns a boolean indicating whether the value is a section lambda.
+func IsLambda(val interface{}) bool {
+	return hooks.IsLambda(val)
+}
+
+// Items returns the contexts that a section over the value renders its content with, each
+// item of an array or slice, otherwise the value itself.
+func Items(val interface{}) []interface{} {
+	return hooks.Items(val)
+}
+
+// Format returns the text an interpolation writes for a value that is not a lambda, before it is escaped.
+func Format(val interface{}) string {
+	return hooks.Format(val)
+}
+
+// Interpolate returns the text an interpolation writes for a value, before it is escaped.
+// Lambdas are called and their result rendered with the context stack.
+func Interpolate(cstack []interface{}, val interface{}) (string, error) {
+	return hooks.Interpolate(cstack, val)
+}
+
+// RenderLambda renders a section lambda with the raw text of the section, which was written with the given delimiters.
+func RenderLambda(w io.Writer, cstack []interface{}, fn interface{}, text, otag, ctag string) error {
+	return hooks.RenderLambda(w, cstack, fn, text, otag, ctag)
+}
+
+// Reindent renders an override of a standalone block, removing the indentation strip that it was written
+// with from each line and adding the indentation add of the block it overrides.
+func Reindent(w io.Writer, strip, add string, render func(w io.Writer) error) error {
+	return render(hooks.Reindent(w, strip, add))
+}
@@ -0,0 +1,5 @@
+module github.com/smarden1/mustache.go
+
+go 1.24
+
+require gopkg.in/yaml.v3 v3.0.1
@@ -0,0 +1,77 @@
+package mustache
+
+import "io"
+
+// RenderParent renders a {{<parent}} tag. The parent is loaded as a partial and any
+// {{$block}} tags directly within the tag override the blocks of the same name in the parent.
+// All other content within the tag is ignored.
+func (r *renderer) renderParent(t *token, cstack []interface{}) error {
+	overrides := make(map[string]*token)
+	for _, child := range t.children {
+		if child.cmd == "$" {
+			overrides[child.args] = child
+		}
+	}
+
+	r.blocks = append(r.blocks, overrides)
+	err := r.renderPartial(t, t.args, cstack)
+	r.blocks = r.blocks[:len(r.blocks)-1]
+
+	return err
+}
+
+// RenderBlock renders a {{$block}} tag. The outermost override for the block is rendered,
+// so the template that is furthest down the inheritance chain takes precedence.
+// If the block has not been overridden then its own content is rendered as the default.
+// An override of a standalone block loses the indentation it was written with and is indented as the block.
+func (r *renderer) renderBlock(t *token, cstack []interface{}) error {
+	for _, overrides := range r.blocks {
+		if override, ok := overrides[t.args]; ok {
+			if override.indent == t.indent {
+				return r.renderChildren(override.children, cstack)
+			}
+
+			w := r.w
+			r.w = &indentWriter{w: w, strip: override.indent, add: t.indent}
+			err := r.renderChildren(override.children, cstack)
+			r.w = w
+
+			return err
+		}
+	}
+
+	return r.renderChildren(t.children, cstack)
+}
+
+// IndentWriter replaces the indentation of each line written, removing as much of strip as each line starts with
+// and adding add before it.
+type indentWriter struct {
+	w          io.Writer
+	strip, add string
+	matched    int  // how much of strip the current line has started with
+	within     bool // boolean indicating whether the indentation of the current line has been replaced
+}
+
+func (iw *indentWriter) Write(p []byte) (int, error) {
+	b := make([]byte, 0, len(p)+len(iw.add))
+	for _, c := range p {
+		if !iw.within {
+			if iw.matched < len(iw.strip) && c == iw.strip[iw.matched] {
+				iw.matched++
+				continue
+			}
+			b = append(b, iw.add...)
+			iw.within = true
+		}
+		b = append(b, c)
+		if c == '\n' {
+			iw.matched, iw.within = 0, false
+		}
+	}
+
+	if _, err := iw.w.Write(b); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
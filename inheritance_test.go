@@ -0,0 +1,81 @@
+package mustache
+
+import "testing"
+
+func TestInheritance(t *testing.T) {
+	type expects struct {
+		desc     string
+		template string
+		partials MapLoader
+		context  map[string]interface{}
+		expected string
+	}
+
+	expected := [...]expects{
+		expects{"Default", "{{$title}}Default title{{/title}}\n", nil, nil, "Default title\n"},
+		expects{"Variable", "{{$foo}}{{bar}}{{/foo}}", nil, map[string]interface{}{"bar": "baz"}, "baz"},
+		expects{"Inherit", "{{<include}}{{/include}}", MapLoader{"include": "{{$foo}}default content{{/foo}}"}, nil, "default content"},
+		expects{"Overridden content", "{{<super}}{{$title}}sub template title{{/title}}{{/super}}",
+			MapLoader{"super": "...{{$title}}Default title{{/title}}..."}, nil, "...sub template title..."},
+		expects{"Data does not override block", "{{<include}}{{$var}}var in template{{/var}}{{/include}}",
+			MapLoader{"include": "{{$var}}var in include{{/var}}"}, map[string]interface{}{"var": "var in data"}, "var in template"},
+		expects{"Overridden parent", "test {{<parent}}{{$stuff}}override{{/stuff}}{{/parent}}",
+			MapLoader{"parent": "{{$stuff}}...{{/stuff}}"}, nil, "test override"},
+		expects{"Two overridden parents", "test {{<parent}}{{$stuff}}override1{{/stuff}}{{/parent}} {{<parent}}{{$stuff}}override2{{/stuff}}{{/parent}}\n",
+			MapLoader{"parent": "|{{$stuff}}...{{/stuff}}{{$default}} default{{/default}}|"}, nil, "test |override1 default| |override2 default|\n"},
+		expects{"Override parent with newlines", "{{<parent}}{{$ballmer}}\npeaked\n\n:(\n{{/ballmer}}{{/parent}}",
+			MapLoader{"parent": "{{$ballmer}}peaking{{/ballmer}}"}, nil, "peaked\n\n:(\n"},
+		expects{"Only one override", "{{<parent}}{{$stuff2}}override two{{/stuff2}}{{/parent}}",
+			MapLoader{"parent": "{{$stuff}}new default one{{/stuff}}, {{$stuff2}}new default two{{/stuff2}}"}, nil, "new default one, override two"},
+		expects{"Parent template", "{{>parent}}|{{<parent}}{{/parent}}",
+			MapLoader{"parent": "{{$foo}}default content{{/foo}}"}, nil, "default content|default content"},
+		expects{"Recursion", "{{<parent}}{{$foo}}override{{/foo}}{{/parent}}",
+			MapLoader{
+				"parent":  "{{$foo}}default content{{/foo}} {{$bar}}{{<parent2}}{{/parent2}}{{/bar}}",
+				"parent2": "{{$foo}}parent2 default content{{/foo}} {{<parent}}{{$bar}}don't recurse{{/bar}}{{/parent}}",
+			}, nil, "override override override don't recurse"},
+		expects{"Multi-level inheritance", "{{<parent}}{{$a}}c{{/a}}{{/parent}}",
+			MapLoader{
+				"parent":      "{{<older}}{{$a}}p{{/a}}{{/older}}",
+				"older":       "{{<grandParent}}{{$a}}o{{/a}}{{/grandParent}}",
+				"grandParent": "{{$a}}g{{/a}}",
+			}, nil, "c"},
+		expects{"Multi-level inheritance, no sub child", "{{<parent}}{{/parent}}",
+			MapLoader{
+				"parent":      "{{<older}}{{$a}}p{{/a}}{{/older}}",
+				"older":       "{{<grandParent}}{{$a}}o{{/a}}{{/grandParent}}",
+				"grandParent": "{{$a}}g{{/a}}",
+			}, nil, "p"},
+		expects{"Text inside parent", "{{<include}} asdfasd {{$foo}}hmm{{/foo}} asdfasd {{/include}}",
+			MapLoader{"include": "{{$foo}}default content{{/foo}}"}, nil, "hmm"},
+		expects{"Block scope", "{{<parent}}{{$block}}I say {{fruit}}.{{/block}}{{/parent}}",
+			MapLoader{"parent": "{{#nested}}{{$block}}You say {{fruit}}.{{/block}}{{/nested}}"},
+			map[string]interface{}{"fruit": "apples", "nested": map[string]interface{}{"fruit": "bananas"}}, "I say bananas."},
+		expects{"Standalone parent", "Hi,\n  {{<parent}}{{/parent}}\n",
+			MapLoader{"parent": "One\nTwo\n"}, nil, "Hi,\n  One\n  Two\n"},
+		expects{"Standalone block", "{{<parent}}{{$block}}\nOne\nTwo\n{{/block}}{{/parent}}\n",
+			MapLoader{"parent": "Hi,\n  {{$block}}{{/block}}\n"}, nil, "Hi,\n  One\n  Two\n"},
+		expects{"Block reindentation", "{{<parent}}{{$block}}\n    one\n    two\n{{/block}}{{/parent}}\n",
+			MapLoader{"parent": "Hi,\n  {{$block}}\n  {{/block}}\n"}, nil, "Hi,\n  one\n  two\n"},
+		expects{"Intrinsic indentation", "{{<parent}}{{$block}}\none\ntwo\n{{/block}}{{/parent}}\n",
+			MapLoader{"parent": "Hi,\n{{$block}}\n    default\n{{/block}}\n"}, nil, "Hi,\n    one\n    two\n"},
+		expects{"Nested block reindentation", "{{<parent}}{{$nested}}\nthree\n{{/nested}}{{/parent}}\n",
+			MapLoader{
+				"parent":      "{{<grandparent}}{{$block}}\n  one\n  {{$nested}}\n    two\n  {{/nested}}\n{{/block}}{{/grandparent}}\n",
+				"grandparent": "{{$block}}default{{/block}}",
+			}, nil, "one\n  three\n"},
+		expects{"Indented parent with a standalone block", "  {{<parent}}{{/parent}}\n{{<parent}}\n  {{$block}}\n  x{{y}}\n  {{/block}}\n{{/parent}}",
+			MapLoader{"parent": "[\n{{$block}}\n\tdefault\n{{/block}}\n]\n"}, map[string]interface{}{"y": "z"}, "  [\n  \tdefault\n  ]\n[\n\txz\n]\n"},
+	}
+
+	for _, e := range expected {
+		template, err := Compile(e.template, Partials(e.partials))
+		if err != nil {
+			t.Errorf("%s: unexpected error while compiling, %s", e.desc, err)
+			continue
+		}
+		if r := template.Render(map[string]interface{}{}, e.context); r != e.expected {
+			t.Errorf("%s: incorrect rendered template, got %q, expected %q", e.desc, r, e.expected)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+// Package hooks gives the genrt package access to unexported functions of the mustache package,
+// which sets them when it is initialized.
+package hooks
+
+import "io"
+
+// The functions are set by the mustache package, see the genrt package for what each does.
+var (
+	Lookup       func(cstack []interface{}, name string) (interface{}, bool, error)
+	LookupKey    func(c interface{}, key string) (interface{}, bool, error)
+	Truthy       func(val interface{}) bool
+	IsLambda     func(val interface{}) bool
+	Items        func(val interface{}) []interface{}
+	Format       func(val interface{}) string
+	Interpolate  func(cstack []interface{}, val interface{}) (string, error)
+	RenderLambda func(w io.Writer, cstack []interface{}, fn interface{}, text, otag, ctag string) error
+	Reindent     func(w io.Writer, strip, add string) io.Writer
+)
@@ -0,0 +1,89 @@
+package mustache
+
+import "strings"
+
+// Reference is a use of a name in a template.
+type Reference struct {
+	Pos
+	Name string // the name as written in the template
+	Path string // the name qualified by the sections it is nested in, i.e. - orders.items.price, or the bare name for partials and parents
+}
+
+// Variables returns each interpolation in the template, in order.
+func (t *Template) Variables() []Reference {
+	return t.references(true, func(n Node) (string, bool) {
+		if v, ok := n.(*Variable); ok {
+			return v.Name, true
+		}
+		return "", false
+	})
+}
+
+// Sections returns each section and inverted section in the template, in order.
+func (t *Template) Sections() []Reference {
+	return t.references(true, func(n Node) (string, bool) {
+		switch n := n.(type) {
+		case *Section:
+			return n.Name, true
+		case *InvertedSection:
+			return n.Name, true
+		}
+		return "", false
+	})
+}
+
+// Partials returns each partial and parent included by the template, in order.
+// The partials are not loaded, so partials they include are not returned. Dynamic partials
+// are left out since their names are only known when rendering. The names of partials are not
+// looked up in the context, so their path is their name.
+func (t *Template) Partials() []Reference {
+	return t.references(false, func(n Node) (string, bool) {
+		switch n := n.(type) {
+		case *Partial:
+			return n.Name, !n.Dynamic
+		case *Parent:
+			return n.Name, true
+		}
+		return "", false
+	})
+}
+
+// References walks the syntax tree and returns a reference for each node that match returns a name for.
+// When qualified, sections add their name to the path of the nodes within them since they change the context.
+func (t *Template) references(qualified bool, match func(Node) (string, bool)) []Reference {
+	var refs []Reference
+
+	var walk func(nodes []Node, scope []string)
+	walk = func(nodes []Node, scope []string) {
+		for _, n := range nodes {
+			if name, ok := match(n); ok {
+				path := name
+				if qualified {
+					path = qualify(scope, name)
+				}
+				refs = append(refs, Reference{Pos: n.Position(), Name: name, Path: path})
+			}
+			if s, ok := n.(*Section); ok && s.Name != "." {
+				walk(s.Nodes, append(scope[:len(scope):len(scope)], s.Name))
+			} else {
+				walk(children(n), scope)
+			}
+		}
+	}
+	walk(t.Nodes(), nil)
+
+	return refs
+}
+
+// Qualify joins the names of the enclosing sections and the name into a dotted path.
+// The implicit iterator refers to the innermost section.
+func qualify(scope []string, name string) string {
+	if name != "." {
+		scope = append(scope[:len(scope):len(scope)], name)
+	}
+	if len(scope) == 0 {
+		return "."
+	}
+
+	return strings.Join(scope, ".")
+}
@@ -0,0 +1,43 @@
+package mustache
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReferences(t *testing.T) {
+	src := "{{title}}\n{{#orders}}{{id}}{{#items}}{{price}} {{.}}{{> row}}{{/items}}{{^items}}{{empty.msg}}{{/items}}{{/orders}}{{<layout}}{{$body}}{{user.name}}{{/body}}{{/layout}}{{>*widget}}"
+	template, err := Compile(src)
+	if err != nil {
+		t.Fatalf("Unexpected error while compiling, %s", err)
+	}
+
+	variables := []Reference{
+		{Pos{1, 1}, "title", "title"},
+		{Pos{2, 12}, "id", "orders.id"},
+		{Pos{2, 28}, "price", "orders.items.price"},
+		{Pos{2, 38}, ".", "orders.items"},
+		{Pos{2, 72}, "empty.msg", "orders.empty.msg"},
+		{Pos{2, 126}, "user.name", "user.name"},
+	}
+	if refs := template.Variables(); !reflect.DeepEqual(refs, variables) {
+		t.Errorf("Incorrect variables, got %v", refs)
+	}
+
+	sections := []Reference{
+		{Pos{2, 1}, "orders", "orders"},
+		{Pos{2, 18}, "items", "orders.items"},
+		{Pos{2, 62}, "items", "orders.items"},
+	}
+	if refs := template.Sections(); !reflect.DeepEqual(refs, sections) {
+		t.Errorf("Incorrect sections, got %v", refs)
+	}
+
+	partials := []Reference{
+		{Pos{2, 43}, "row", "row"},
+		{Pos{2, 106}, "layout", "layout"},
+	}
+	if refs := template.Partials(); !reflect.DeepEqual(refs, partials) {
+		t.Errorf("Incorrect partials, got %v", refs)
+	}
+}
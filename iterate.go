@@ -0,0 +1,150 @@
+package mustache
+
+import (
+	"fmt"
+	"iter"
+	"reflect"
+	"sort"
+)
+
+// RenderSection renders the children of a section for a truthy value.
+// Lists are iterated over, pushing each item onto the context stack. When the template iterates
+// over all collections, channels, iterator functions and the chosen types of maps are also iterated over.
+// Any other value is pushed onto the context stack and the children are rendered once.
+func (r *renderer) renderSection(t *token, val interface{}, cstack []interface{}) error {
+	v := indirect(reflect.ValueOf(val))
+
+	switch {
+	case v.Kind() == reflect.Array || v.Kind() == reflect.Slice:
+		i := 0
+		return r.renderItems(t, cstack, v.Len(), func() (reflect.Value, reflect.Value, bool) {
+			if i >= v.Len() {
+				return reflect.Value{}, reflect.Value{}, false
+			}
+			i++
+			return reflect.Value{}, v.Index(i - 1), true
+		})
+	case !r.template.iterateAll:
+	case v.Kind() == reflect.Map && r.template.iterateMaps[v.Type()]:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return lessValue(keys[i], keys[j])
+		})
+		i := 0
+		return r.renderItems(t, cstack, len(keys), func() (reflect.Value, reflect.Value, bool) {
+			if i >= len(keys) {
+				return reflect.Value{}, reflect.Value{}, false
+			}
+			i++
+			return keys[i-1], v.MapIndex(keys[i-1]), true
+		})
+	case v.Kind() == reflect.Chan && v.Type().ChanDir()&reflect.RecvDir != 0:
+		var recvErr error
+		err := r.renderItems(t, cstack, -1, func() (reflect.Value, reflect.Value, bool) {
+			item, ok, err := r.recv(t, v)
+			if err != nil {
+				recvErr = err
+			}
+			return reflect.Value{}, item, ok
+		})
+		if err != nil {
+			return err
+		}
+		return recvErr
+	case v.Kind() == reflect.Func && v.Type().CanSeq2():
+		next, stop := iter.Pull2(v.Seq2())
+		defer stop()
+		return r.renderItems(t, cstack, -1, next)
+	case v.Kind() == reflect.Func && v.Type().CanSeq():
+		next, stop := iter.Pull(v.Seq())
+		defer stop()
+		return r.renderItems(t, cstack, -1, func() (reflect.Value, reflect.Value, bool) {
+			item, ok := next()
+			return reflect.Value{}, item, ok
+		})
+	}
+
+	return r.renderChildren(t.children, append(cstack, val))
+}
+
+// RenderItems renders the children of a section once for each item returned by next.
+// Each item is pushed onto the context stack, along with its key as @key when it has one and
+// the iteration metadata when it is enabled. The length is -1 if it is not known in advance,
+// in which case the next item is read before rendering the current one so that @last is known.
+func (r *renderer) renderItems(t *token, cstack []interface{}, length int, next func() (reflect.Value, reflect.Value, bool)) error {
+	key, item, ok := next()
+	for i := 0; ok; i++ {
+		if err := r.iterate(t); err != nil {
+			return err
+		}
+
+		stack := cstack
+		last := i == length-1
+		var nextKey, nextItem reflect.Value
+		var nextOk bool
+		if r.template.iterationMetadata {
+			if length < 0 {
+				nextKey, nextItem, nextOk = next()
+				last = !nextOk
+			}
+			stack = append(stack, iterationMetadata(i, last, length))
+		}
+		if key.IsValid() {
+			stack = append(stack, map[string]interface{}{"@key": valueInterface(key)})
+		}
+
+		if err := r.renderChildren(t.children, append(stack, valueInterface(item))); err != nil {
+			return err
+		}
+
+		if r.template.iterationMetadata && length < 0 {
+			key, item, ok = nextKey, nextItem, nextOk
+		} else {
+			key, item, ok = next()
+		}
+	}
+
+	return nil
+}
+
+// IterationMetadata returns the context holding the metadata for an item when iterating.
+// The length is left out if it is not known.
+func iterationMetadata(i int, last bool, length int) map[string]interface{} {
+	m := map[string]interface{}{
+		"@index":  i,
+		"@index1": i + 1,
+		"@first":  i == 0,
+		"@last":   last,
+	}
+	if length >= 0 {
+		m["@length"] = length
+	}
+
+	return m
+}
+
+// ValueInterface returns the value held by v, or nil if v is not valid.
+func valueInterface(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+
+	return v.Interface()
+}
+
+// LessValue orders map keys, numbers and strings are compared by value
+// and anything else is compared by its printed form.
+func lessValue(a, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() < b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return a.Uint() < b.Uint()
+	case reflect.Float32, reflect.Float64:
+		return a.Float() < b.Float()
+	case reflect.String:
+		return a.String() < b.String()
+	}
+
+	return fmt.Sprint(valueInterface(a)) < fmt.Sprint(valueInterface(b))
+}
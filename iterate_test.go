@@ -0,0 +1,85 @@
+package mustache
+
+import (
+	"bytes"
+	"iter"
+	"testing"
+)
+
+func TestIterateAll(t *testing.T) {
+	letters := func(yield func(string) bool) {
+		for _, s := range []string{"x", "y", "z"} {
+			if !yield(s) {
+				return
+			}
+		}
+	}
+	pairs := func(yield func(int, string) bool) {
+		_ = yield(1, "one") && yield(2, "two")
+	}
+	ch := func() chan int {
+		c := make(chan int, 3)
+		c <- 1
+		c <- 2
+		c <- 3
+		close(c)
+		return c
+	}
+
+	type expects struct {
+		template string
+		context  map[string]interface{}
+		expected string
+	}
+
+	expected := [...]expects{
+		expects{"{{#m}}{{@key}}={{.}};{{/m}}", map[string]interface{}{"m": map[string]int{"b": 2, "a": 1, "c": 3}}, "a=1;b=2;c=3;"},
+		expects{"{{#m}}{{@key}}={{name}};{{/m}}", map[string]interface{}{"m": map[int]map[string]string{10: {"name": "ten"}, 9: {"name": "nine"}}}, "9=nine;10=ten;"},
+		expects{"{{#c}}{{.}}{{^@last}},{{/@last}}{{/c}}", map[string]interface{}{"c": ch()}, "1,2,3"},
+		expects{"{{#seq}}{{@index}}{{.}}{{/seq}}", map[string]interface{}{"seq": iter.Seq[string](letters)}, "0x1y2z"},
+		expects{"{{#seq}}{{.}}{{#@last}}!{{/@last}}{{/seq}}", map[string]interface{}{"seq": letters}, "xyz!"},
+		expects{"{{#seq2}}{{@key}}:{{.}} {{/seq2}}", map[string]interface{}{"seq2": iter.Seq2[int, string](pairs)}, "1:one 2:two "},
+		expects{"{{#m}}{{@key}}{{/m}}{{^m}}empty{{/m}}", map[string]interface{}{"m": map[string]int{}}, "empty"},
+	}
+
+	for _, e := range expected {
+		template, _ := Compile(e.template, IterateAll(map[string]int(nil), map[int]map[string]string(nil)), IterationMetadata())
+
+		var b bytes.Buffer
+		if err := template.Execute(&b, e.context); err != nil || b.String() != e.expected {
+			t.Errorf("Incorrect rendered template for %s, got %s and %v, expected %s", e.template, b.String(), err, e.expected)
+		}
+	}
+
+	// maps of types that are not chosen are still used as the context, such as objects decoded from JSON
+	user := map[string]interface{}{"user": map[string]interface{}{"name": "steve", "admin": true}}
+	template, _ := Compile("{{#user}}{{name}}{{#admin}}!{{/admin}}{{/user}}", IterateAll(map[string]int(nil)))
+	if r, err := render(template, user); err != nil || r != "steve!" {
+		t.Errorf("Expected the object to be used as the context, got %s and %v", r, err)
+	}
+
+	// without the option maps are used as the context
+	if r, _ := Render("{{#m}}{{a}}{{@key}}{{/m}}", map[string]interface{}{"m": map[string]int{"a": 1, "b": 2}}); r != "1" {
+		t.Errorf("Expected the map to be used as the context, got %s", r)
+	}
+}
+
+func TestIterateAllStopsEarly(t *testing.T) {
+	stopped := false
+	seq := func(yield func(int) bool) {
+		defer func() { stopped = true }()
+		for i := 0; ; i++ {
+			if !yield(i) {
+				return
+			}
+		}
+	}
+
+	template, _ := Compile("{{#seq}}{{.}}{{/seq}}", IterateAll())
+	if err := template.Execute(&failingWriter{n: 3}, map[string]interface{}{"seq": seq}); err == nil {
+		t.Errorf("Expected the write error to be returned")
+	}
+	if !stopped {
+		t.Errorf("Expected the iterator to be stopped")
+	}
+}
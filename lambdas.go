@@ -0,0 +1,72 @@
+package mustache
+
+import (
+	"bytes"
+	"io"
+)
+
+// IsLambda returns a boolean indicating whether the value can be called as a section lambda.
+//
+// Lambdas may have one of the following forms
+//
+//	func(text string) string                              the result is rendered as a template
+//	func(text string, render func(string) string) string  the result is written as is
+//
+// where text is the raw, unrendered text of the section and render renders text
+// as a template with the current context.
+func isLambda(val interface{}) bool {
+	switch val.(type) {
+	case func(string) string, func(string, func(string) string) string:
+		return true
+	}
+
+	return false
+}
+
+// RenderSectionLambda calls a section lambda with the raw text of the section and writes the result.
+func (r *renderer) renderSectionLambda(t *token, fn interface{}, cstack []interface{}) error {
+	var s string
+	var err error
+
+	switch fn := fn.(type) {
+	case func(string) string:
+		s, err = r.renderString(fn(t.text), t.otag, t.ctag, cstack)
+	case func(string, func(string) string) string:
+		s = fn(t.text, func(text string) string {
+			var rendered string
+			if rendered, err = r.renderString(text, t.otag, t.ctag, cstack); err != nil {
+				return ""
+			}
+			return rendered
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(r.w, s)
+	return err
+}
+
+// RenderString compiles the template with the given delimiters and renders it
+// with the current context stack, returning the output. The output counts towards MaxOutput.
+func (r *renderer) renderString(template, otag, ctag string, cstack []interface{}) (string, error) {
+	t, err := r.template.compile(r.name, template, otag, ctag)
+	if err != nil {
+		return "", err
+	}
+
+	var b bytes.Buffer
+	sub := *r
+	sub.w = &b
+	if r.output != nil {
+		// the output is counted from what has been written so far, so the limit applies within lambdas
+		sub.output = &limitWriter{w: &b, n: r.output.n, max: r.output.max}
+		sub.w = sub.output
+	}
+	if err := t.render(&sub, cstack); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,76 @@
+package mustache
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestLambdas covers the cases from the optional ~lambdas spec, which can not be run
+// from the spec files since the lambdas are given as source code for other languages.
+func TestLambdas(t *testing.T) {
+	type expects struct {
+		desc     string
+		template string
+		context  map[string]interface{}
+		expected string
+	}
+
+	calls := 0
+	expected := [...]expects{
+		expects{"Interpolation", "Hello, {{lambda}}!", map[string]interface{}{
+			"lambda": func() string { return "world" },
+		}, "Hello, world!"},
+		expects{"Interpolation - Expansion", "Hello, {{lambda}}!", map[string]interface{}{
+			"planet": "world",
+			"lambda": func() string { return "{{planet}}" },
+		}, "Hello, world!"},
+		expects{"Interpolation - Alternate Delimiters", "{{= | | =}}\nHello, (|&lambda|)!", map[string]interface{}{
+			"planet": "world",
+			"lambda": func() string { return "|planet| => {{planet}}" },
+		}, "Hello, (|planet| => world)!"},
+		expects{"Interpolation - Multiple Calls", "{{lambda}} == {{{lambda}}} == {{lambda}}", map[string]interface{}{
+			"lambda": func() string { calls++; return strings.Repeat("I", calls) },
+		}, "I == II == III"},
+		expects{"Escaping", "<{{lambda}}{{{lambda}}}", map[string]interface{}{
+			"lambda": func() string { return ">" },
+		}, "<&gt;>"},
+		expects{"Section", "<{{#lambda}}{{x}}{{/lambda}}>", map[string]interface{}{
+			"x": "Error!",
+			"lambda": func(text string) string {
+				if text == "{{x}}" {
+					return "yes"
+				}
+				return "no"
+			},
+		}, "<yes>"},
+		expects{"Section - Expansion", "<{{#lambda}}-{{/lambda}}>", map[string]interface{}{
+			"planet": "Earth",
+			"lambda": func(text string) string { return text + "{{planet}}" + text },
+		}, "<-Earth->"},
+		expects{"Section - Alternate Delimiters", "{{= | | =}}<|#lambda|-|/lambda|>", map[string]interface{}{
+			"planet": "Earth",
+			"lambda": func(text string) string { return text + "{{planet}} => |planet|" + text },
+		}, "<-{{planet}} => Earth->"},
+		expects{"Section - Multiple Calls", "{{#lambda}}FILE{{/lambda}} != {{#lambda}}LINE{{/lambda}}", map[string]interface{}{
+			"lambda": func(text string) string { return "__" + text + "__" },
+		}, "__FILE__ != __LINE__"},
+		expects{"Inverted Section", "<{{^lambda}}{{static}}{{/lambda}}>", map[string]interface{}{
+			"static": "static",
+			"lambda": func(text string) string { return "" },
+		}, "<>"},
+		expects{"Section - Render Function", "{{#bold}}Hi {{name}}.{{/bold}}", map[string]interface{}{
+			"name": "Tater",
+			"bold": func(text string, render func(string) string) string { return "<b>" + render(text) + "</b>" },
+		}, "<b>Hi Tater.</b>"},
+		expects{"Section - Nested Raw Text", "{{#a}}{{#lambda}}{{#b}}{{c}}{{/b}}{{/lambda}}{{/a}}", map[string]interface{}{
+			"a":      true,
+			"lambda": func(text string, render func(string) string) string { return text },
+		}, "{{#b}}{{c}}{{/b}}"},
+	}
+
+	for _, e := range expected {
+		if r, err := Render(e.template, e.context); r != e.expected || err != nil {
+			t.Errorf("%s: incorrect rendered template, got %q and %v, expected %q", e.desc, r, err, e.expected)
+		}
+	}
+}
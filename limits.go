@@ -0,0 +1,117 @@
+package mustache
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+var (
+	// ErrMaxDepth is returned, wrapped with the position of the section, when sections are nested more deeply than MaxDepth allows.
+	ErrMaxDepth = errors.New("exceeded the maximum section depth")
+	// ErrMaxIterations is returned, wrapped with the position of the section, when sections iterate more times in total than MaxIterations allows.
+	ErrMaxIterations = errors.New("exceeded the maximum number of iterations")
+	// ErrMaxOutput is returned, wrapped, when rendering writes more bytes than MaxOutput allows.
+	ErrMaxOutput = errors.New("exceeded the maximum output size")
+)
+
+// MaxDepth limits how deeply sections and inverted sections may be nested while rendering,
+// including sections within partials. By default there is no limit.
+func MaxDepth(depth int) Option {
+	return func(t *Template) {
+		t.maxDepth = depth
+	}
+}
+
+// MaxIterations limits the number of items that sections may iterate over in total during a single render.
+// By default there is no limit.
+func MaxIterations(iterations int) Option {
+	return func(t *Template) {
+		t.maxIterations = iterations
+	}
+}
+
+// MaxOutput limits the number of bytes a single render may write. Output is streamed, so the output
+// written before the limit is reached has already been written when the error is returned.
+// By default there is no limit.
+func MaxOutput(bytes int64) Option {
+	return func(t *Template) {
+		t.maxOutput = bytes
+	}
+}
+
+// EnterSection records that a section is being rendered, checking that it is not nested too deeply.
+func (r *renderer) enterSection(t *token) error {
+	r.sections++
+	if r.template.maxDepth > 0 && r.sections > r.template.maxDepth {
+		return fmt.Errorf("%s Render error: %w of %d for %s", position(r.name, t.line, t.col), ErrMaxDepth, r.template.maxDepth, t.tag)
+	}
+
+	return nil
+}
+
+// LeaveSection records that a section has been rendered.
+func (r *renderer) leaveSection() {
+	r.sections--
+}
+
+// Iterate records an iteration of a section, checking the total number of iterations and
+// whether the context of the render is done.
+func (r *renderer) iterate(t *token) error {
+	if r.ctx != nil {
+		if err := r.ctx.Err(); err != nil {
+			return r.contextError(t, err)
+		}
+	}
+	if r.template.maxIterations > 0 {
+		*r.iterations++
+		if *r.iterations > r.template.maxIterations {
+			return fmt.Errorf("%s Render error: %w of %d for %s", position(r.name, t.line, t.col), ErrMaxIterations, r.template.maxIterations, t.tag)
+		}
+	}
+
+	return nil
+}
+
+// Recv receives the next item from a channel section, giving up with the error of the context
+// if it is done before an item is received.
+func (r *renderer) recv(t *token, v reflect.Value) (reflect.Value, bool, error) {
+	if r.ctx == nil {
+		item, ok := v.Recv()
+		return item, ok, nil
+	}
+
+	chosen, item, ok := reflect.Select([]reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: v},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(r.ctx.Done())},
+	})
+	if chosen == 1 {
+		return reflect.Value{}, false, r.contextError(t, r.ctx.Err())
+	}
+
+	return item, ok, nil
+}
+
+// ContextError wraps the error of the render's context with the position of the tag that stopped.
+func (r *renderer) contextError(t *token, err error) error {
+	return fmt.Errorf("%s Render error: %w for %s", position(r.name, t.line, t.col), err, t.tag)
+}
+
+// LimitWriter writes to w until max bytes have been written, after which it fails.
+type limitWriter struct {
+	w      io.Writer
+	n, max int64
+}
+
+// Write writes p if it fits within the limit, otherwise nothing is written and an error is returned.
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if l.n+int64(len(p)) > l.max {
+		return 0, fmt.Errorf("Render error: %w of %d bytes", ErrMaxOutput, l.max)
+	}
+
+	n, err := l.w.Write(p)
+	l.n += int64(n)
+
+	return n, err
+}
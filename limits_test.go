@@ -0,0 +1,146 @@
+package mustache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLimits(t *testing.T) {
+	type expects struct {
+		template string
+		options  []Option
+		expected string
+		err      error
+		message  string
+	}
+
+	data := map[string]interface{}{
+		"a":    map[string]interface{}{"b": map[string]interface{}{"c": "deep"}},
+		"list": []int{1, 2, 3},
+		"lambda": func() string {
+			return "{{#list}}{{.}}{{/list}}"
+		},
+		"big": func(text string) string {
+			return "{{#list}}" + strings.Repeat(text, 1000000) + "{{/list}}"
+		},
+		"render": func(text string, render func(string) string) string {
+			if render("12345678") != "" {
+				panic("the output of the lambda was not limited")
+			}
+			return ""
+		},
+	}
+
+	e := [...]expects{
+		expects{"{{#a}}{{#b}}{{c}}{{/b}}{{/a}}", []Option{MaxDepth(2)}, "deep", nil, ""},
+		expects{"{{#a}}{{#b}}{{#c}}{{.}}{{/c}}{{/b}}{{/a}}", []Option{MaxDepth(2)}, "", ErrMaxDepth, "page:1:13: Render error: exceeded the maximum section depth of 2 for {{#c}}"},
+		expects{"{{#a}}\n{{^x}}{{^x}}{{/x}}{{/x}}{{/a}}", []Option{MaxDepth(2)}, "", ErrMaxDepth, "page:2:7: Render error: exceeded the maximum section depth of 2 for {{^x}}"},
+		expects{"{{#a}}{{> p}}{{/a}}", []Option{MaxDepth(2), Partials(MapLoader{"p": "{{#b}}{{#c}}{{.}}{{/c}}{{/b}}"})}, "", ErrMaxDepth, "p:1:7: Render error: exceeded the maximum section depth of 2 for {{#c}}"},
+		expects{"{{#list}}{{.}}{{/list}}{{#list}}{{.}}{{/list}}", []Option{MaxIterations(6)}, "123123", nil, ""},
+		expects{"{{#list}}{{.}}{{/list}}{{#list}}{{.}}{{/list}}", []Option{MaxIterations(5)}, "12312", ErrMaxIterations, "page:1:24: Render error: exceeded the maximum number of iterations of 5 for {{#list}}"},
+		expects{"{{#list}}{{lambda}}{{/list}}", []Option{MaxIterations(5)}, "", ErrMaxIterations, "page:1:1: Render error: exceeded the maximum number of iterations of 5 for {{#list}}"},
+		expects{"{{#list}}{{.}}{{/list}}", []Option{MaxOutput(3)}, "123", nil, ""},
+		expects{"{{#list}}{{.}}{{/list}}", []Option{MaxOutput(2)}, "12", ErrMaxOutput, "Render error: exceeded the maximum output size of 2 bytes"},
+		expects{"{{#list}}{{.}}{{/list}}{{#big}}x{{/big}}", []Option{MaxOutput(10)}, "123", ErrMaxOutput, "Render error: exceeded the maximum output size of 10 bytes"},
+		expects{"{{#list}}{{.}}{{/list}}{{#render}}x{{/render}}", []Option{MaxOutput(10)}, "123", ErrMaxOutput, "Render error: exceeded the maximum output size of 10 bytes"},
+	}
+
+	for _, ex := range e {
+		template, err := Compile(ex.template, append(ex.options, Name("page"))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var b bytes.Buffer
+		err = template.Execute(&b, data)
+		if ex.err == nil {
+			if err != nil || b.String() != ex.expected {
+				t.Errorf("%q expected %q, but got %q (%v)", ex.template, ex.expected, b.String(), err)
+			}
+			continue
+		}
+		if !errors.Is(err, ex.err) || err.Error() != ex.message {
+			t.Errorf("%q expected error %q, but got %v", ex.template, ex.message, err)
+		}
+		if ex.expected != "" && b.String() != ex.expected {
+			t.Errorf("%q expected output %q before the error, but got %q", ex.template, ex.expected, b.String())
+		}
+	}
+}
+
+func TestExecuteContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	i := 0
+	next := func() string {
+		i++
+		if i == 2 {
+			cancel()
+		}
+		return "{{.}}"
+	}
+
+	template, _ := Compile("{{#list}}{{next}}{{/list}}", Name("page"))
+
+	var b bytes.Buffer
+	err := template.ExecuteContext(ctx, &b, map[string]interface{}{"list": []int{1, 2, 3}, "next": next})
+	if !errors.Is(err, context.Canceled) || err.Error() != "page:1:1: Render error: context canceled for {{#list}}" {
+		t.Errorf("Expected the render to be cancelled, got %v", err)
+	}
+	if b.String() != "12" {
+		t.Errorf("Expected the output before cancelling, got %q", b.String())
+	}
+}
+
+func TestExecuteContextPartials(t *testing.T) {
+	partials := MapLoader{"item": "x", "layout": "[{{$body}}{{/body}}]"}
+	for _, template := range []string{"{{> item}}{{stop}}{{> item}}", "{{> item}}{{stop}}{{<layout}}{{/layout}}"} {
+		ctx, cancel := context.WithCancel(context.Background())
+		stop := func() string {
+			cancel()
+			return ""
+		}
+		tmpl, _ := Compile(template, Name("page"), Partials(partials))
+
+		var b bytes.Buffer
+		err := tmpl.ExecuteContext(ctx, &b, map[string]interface{}{"stop": stop})
+		if !errors.Is(err, context.Canceled) || !strings.HasPrefix(err.Error(), "page:1:19: Render error: context canceled for {{") {
+			t.Errorf("%s expected the render to be cancelled at the second partial, got %v", template, err)
+		}
+		if b.String() != "x" {
+			t.Errorf("%s expected the output before cancelling, got %q", template, b.String())
+		}
+	}
+}
+
+func TestExecuteContextChannel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	items := make(chan int, 1)
+	items <- 1
+
+	template, _ := Compile("{{#items}}{{.}}{{/items}}", Name("page"), IterateAll())
+
+	done := make(chan error, 1)
+	var b bytes.Buffer
+	go func() {
+		done <- template.ExecuteContext(ctx, &b, map[string]interface{}{"items": items})
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) || err.Error() != "page:1:1: Render error: context deadline exceeded for {{#items}}" {
+			t.Errorf("Expected the render to time out, got %v", err)
+		}
+		if b.String() != "1" {
+			t.Errorf("Expected the output before timing out, got %q", b.String())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the render to stop while waiting on the channel")
+	}
+}
@@ -0,0 +1,141 @@
+package mustache
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// fieldCache holds the fields of each struct type by the names they can be looked up with.
+var fieldCache sync.Map // map[reflect.Type]map[string][]int
+
+// LookupKey looks up a single key, without any dots, in a context value.
+//
+// Pointers and interfaces are dereferenced until a map or struct is found.
+// Maps are indexed by the key. Structs are searched for an exported field, including
+// fields promoted from embedded structs, named by a `mustache:"name"` tag, a `json:"name"` tag
+// or the name of the field. Methods named by the key are called if they take no arguments
+// and return a single value or a value and an error, the error is returned if it is not nil.
+func lookupKey(c interface{}, key string) (interface{}, bool, error) {
+	v := reflect.ValueOf(c)
+
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, false, nil
+		}
+		if val, ok, err := callMethod(v, key); ok || err != nil {
+			return val, ok, err
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() == reflect.String {
+			if val := v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key())); val.IsValid() {
+				return val.Interface(), true, nil
+			}
+		}
+	case reflect.Struct:
+		if index, ok := structFields(v.Type())[key]; ok {
+			if val, err := v.FieldByIndexErr(index); err == nil {
+				return val.Interface(), true, nil
+			}
+			// a nil embedded pointer
+			return nil, false, nil
+		}
+		if !v.CanAddr() {
+			// copy the struct so that methods with pointer receivers can be called
+			p := reflect.New(v.Type())
+			p.Elem().Set(v)
+			return callMethod(p, key)
+		}
+		return callMethod(v.Addr(), key)
+	}
+
+	if !v.IsValid() {
+		return nil, false, nil
+	}
+	return callMethod(v, key)
+}
+
+// CallMethod calls the method named key on the value if it takes no arguments
+// and returns a single value or a value and an error.
+func callMethod(v reflect.Value, key string) (interface{}, bool, error) {
+	m := v.MethodByName(key)
+	if !m.IsValid() {
+		return nil, false, nil
+	}
+
+	t := m.Type()
+	if t.NumIn() != 0 || t.NumOut() == 0 || t.NumOut() > 2 || (t.NumOut() == 2 && !t.Out(1).Implements(errorType)) {
+		return nil, false, nil
+	}
+
+	out := m.Call(nil)
+	if len(out) == 2 && !out[1].IsNil() {
+		return nil, false, out[1].Interface().(error)
+	}
+
+	return out[0].Interface(), true, nil
+}
+
+// StructFields returns the index of each exported field of the struct type by name.
+// Names from mustache tags take precedence over json tags, which take precedence over field names.
+// Json tags are only used for fields without a mustache tag.
+func structFields(t reflect.Type) map[string][]int {
+	if fields, ok := fieldCache.Load(t); ok {
+		return fields.(map[string][]int)
+	}
+
+	byName := make(map[string][]int)
+	byJSON := make(map[string][]int)
+	byTag := make(map[string][]int)
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() {
+			continue
+		}
+
+		mustacheName, mustacheSkip := tagName(f.Tag.Get("mustache"))
+		jsonName, jsonSkip := tagName(f.Tag.Get("json"))
+		if mustacheSkip || (jsonSkip && mustacheName == "") {
+			continue
+		}
+
+		// shallower fields are listed before the fields they hide, keep the first
+		if _, ok := byName[f.Name]; !ok {
+			byName[f.Name] = f.Index
+		}
+		if _, ok := byJSON[jsonName]; !ok && jsonName != "" && mustacheName == "" {
+			byJSON[jsonName] = f.Index
+		}
+		if _, ok := byTag[mustacheName]; !ok && mustacheName != "" {
+			byTag[mustacheName] = f.Index
+		}
+	}
+
+	for name, index := range byJSON {
+		byName[name] = index
+	}
+	for name, index := range byTag {
+		byName[name] = index
+	}
+
+	fields, _ := fieldCache.LoadOrStore(t, byName)
+	return fields.(map[string][]int)
+}
+
+// TagName parses a struct tag value such as "name,omitempty" and returns the name
+// and whether the field should be skipped, which is indicated by a tag of "-".
+func tagName(tag string) (string, bool) {
+	if tag == "-" {
+		return "", true
+	}
+	if i := strings.Index(tag, ","); i >= 0 {
+		tag = tag[:i]
+	}
+
+	return tag, false
+}
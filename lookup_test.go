@@ -0,0 +1,132 @@
+package mustache
+
+import (
+	"errors"
+	"testing"
+)
+
+type lookupBase struct {
+	ID      int `json:"id"`
+	Created string
+}
+
+type lookupUser struct {
+	*lookupBase
+	First    string `json:"first_name"`
+	Last     string `json:"last_name" mustache:"surname"`
+	Password string `json:"-"`
+	Nickname string `json:"nick,omitempty"`
+	Hidden   string `mustache:"-"`
+	internal string
+	Address  *lookupAddress
+}
+
+type lookupAddress struct {
+	City string `json:"city"`
+}
+
+func (u lookupUser) FullName() string {
+	return u.First + " " + u.Last
+}
+
+func (u *lookupUser) Initials() (string, error) {
+	if u.First == "" {
+		return "", errors.New("no first name")
+	}
+	return u.First[:1] + u.Last[:1], nil
+}
+
+func (u lookupUser) Greet(name string) string {
+	return "hi " + name
+}
+
+func TestLookupKey(t *testing.T) {
+	user := lookupUser{
+		lookupBase: &lookupBase{ID: 7, Created: "today"},
+		First:      "Steve",
+		Last:       "M",
+		Password:   "secret",
+		Nickname:   "stove",
+		Hidden:     "hidden",
+		internal:   "internal",
+		Address:    &lookupAddress{City: "Brooklyn"},
+	}
+
+	type expects struct {
+		key      string
+		expected interface{}
+		ok       bool
+	}
+
+	e := [...]expects{
+		expects{"first_name", "Steve", true},
+		expects{"First", "Steve", true},
+		expects{"surname", "M", true},
+		expects{"last_name", nil, false},
+		expects{"Password", nil, false},
+		expects{"nick", "stove", true},
+		expects{"Hidden", nil, false},
+		expects{"internal", nil, false},
+		expects{"id", 7, true},
+		expects{"Created", "today", true},
+		expects{"FullName", "Steve M", true},
+		expects{"Initials", "SM", true},
+		expects{"Greet", nil, false},
+	}
+
+	for _, context := range [...]interface{}{user, &user} {
+		for _, ex := range e {
+			val, ok, err := lookupKey(context, ex.key)
+			if ok != ex.ok || err != nil || (ok && val != ex.expected) {
+				t.Errorf("Incorrect lookup of %s in %T, got %v, %t and %v", ex.key, context, val, ok, err)
+			}
+		}
+	}
+
+	if _, ok, _ := lookupKey(lookupUser{}, "id"); ok {
+		t.Errorf("Expected fields of a nil embedded struct to not be found")
+	}
+	if _, ok, _ := lookupKey((*lookupUser)(nil), "First"); ok {
+		t.Errorf("Expected fields of a nil pointer to not be found")
+	}
+	if _, _, err := lookupKey(lookupUser{Last: "M"}, "Initials"); err == nil {
+		t.Errorf("Expected the error returned by the method")
+	}
+}
+
+func TestRenderStructs(t *testing.T) {
+	user := &lookupUser{
+		lookupBase: &lookupBase{ID: 7},
+		First:      "Steve",
+		Last:       "M",
+		Address:    &lookupAddress{City: "Brooklyn"},
+	}
+
+	type expects struct {
+		template string
+		expected string
+	}
+
+	e := [...]expects{
+		expects{"{{first_name}} {{surname}}", "Steve M"},
+		expects{"{{FullName}} ({{Initials}}) #{{id}}", "Steve M (SM) #7"},
+		expects{"{{#Address}}{{city}}{{/Address}}", "Brooklyn"},
+		expects{"{{Address.city}}", "Brooklyn"},
+		expects{"{{#users}}{{first_name}},{{/users}}", "Steve,Steve,"},
+	}
+
+	for _, ex := range e {
+		r, _ := Render(ex.template, map[string]interface{}{"users": &[]*lookupUser{user, user}}, user)
+		if r != ex.expected {
+			t.Errorf("Incorrect rendered template, got %s, expected %s", r, ex.expected)
+		}
+	}
+
+	var b failingWriter
+	b.n = 10
+	template, _ := Compile("{{Initials}}", Name("page"))
+	err := template.Execute(&b, &lookupUser{})
+	if err == nil || err.Error() != "page:1:1: Render error: Initials returned an error for {{Initials}}: no first name" {
+		t.Errorf("Expected the error returned by the method, got %v", err)
+	}
+}
@@ -2,28 +2,26 @@ package mustache
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"html"
-	"io/ioutil"
+	"io"
+	"io/fs"
 	"reflect"
 	"strings"
+	"sync"
 )
 
 // default opening and closing tags
 var defaultOtag = "{{"
 var defaultCtag = "}}"
 
+// maxPartialDepth is how deeply partials may be nested while rendering,
+// which guards against recursive partials that never terminate.
+const maxPartialDepth = 100
+
 // Commands are the valid commands in mustache.
-var commands = map[string]bool{
-	"#": true,
-	"^": true,
-	"/": true,
-	"<": true,
-	">": true,
-	"=": true,
-	"!": true,
-	"&": true,
-}
+const commands = "#^/<>$=!&"
 
 // Token represents a command or bit of text in the template represented as a tree structure.
 // tokens can be within or not, which indicate whether they are a mustache command or if
@@ -32,8 +30,15 @@ type token struct {
 	cmd        string   // the command for the current token. interpolation and simple text will have an empty command
 	args       string   // the args for the given command. can contain the variable to be interpolated or simple text to be displayed
 	within     bool     // boolean indicating whether this token represent commands within tags or outside of them
-	notEscaped bool     // boolean indicating whether the text should be html escaped or not
+	notEscaped bool     // boolean indicating whether the text should be escaped or not
 	children   []*token // children tokens are attached for sections. children tokens will only be rendered if their parent is
+	text       string   // the raw template text within a section, which is passed to lambdas
+	otag, ctag string   // the delimiters in effect for a tag, which are used to render lambdas
+	filters    []string // the names of the filters applied to an interpolated value, in order
+	tag        string   // the tag as written in the template, used when reporting errors
+	line, col  int      // the position of the tag or text in the template
+	indent     string   // the whitespace before a standalone partial or parent, which is added to each line of it, or the indentation of the content of a standalone block
+	dynamic    bool     // boolean indicating whether the args of a partial name the value holding the name of the partial
 }
 
 // AddChild adds a child token to the current token
@@ -46,7 +51,7 @@ func (t *token) isEmpty() bool {
 	return len(t.children) == 0 && t.cmd == "" && t.args == ""
 }
 
-// Render recursively walks the tokens and writes it's output to a buffer.
+// Render recursively walks the tokens and writes it's output to w.
 // The cstack represents the context stack and contains the valid context for
 // a token. This context is the data that is provided for rendering a template.
 // However the context stack gets scoped as we walk through the token tree.
@@ -60,64 +65,230 @@ func (t *token) isEmpty() bool {
 //      a template of {{#b}}{{a}}{{/b}} will return foo
 //      a template of {{#b}}{{d}}{{/b}} will return biz
 //      a template of {{d}} will return hidden
-func (t *token) render(cstack []interface{}, output *bytes.Buffer) {
+//
+// The first error returned by the writer stops rendering and is returned.
+// Panics while evaluating a tag, such as from a lambda or method, are recovered and returned as errors.
+func (t *token) render(r *renderer, cstack []interface{}) (err error) {
 	if t.within {
+		defer func() {
+			if p := recover(); p != nil {
+				err = r.panicError(t, p)
+			}
+		}()
+
+		if t.cmd == "#" || t.cmd == "^" {
+			if err := r.enterSection(t); err != nil {
+				return err
+			}
+			defer r.leaveSection()
+		}
+
 		if t.cmd == "#" {
-			if val, ok := contextStackContains(cstack, t.args); ok && !isFalsey(val) {
-				kind := reflect.TypeOf(val).Kind()
-				if kind == reflect.Array || kind == reflect.Slice {
-					a := reflect.ValueOf(val)
-
-					for i := 0; i < a.Len(); i++ {
-						for _, child := range t.children {
-							child.render(append(cstack, a.Index(i).Interface()), output)
-						}
-					}
-				} else if kind == reflect.Map {
-					for _, child := range t.children {
-						child.render(append(cstack, val), output)
-					}
-				} else {
-					for _, child := range t.children {
-						child.render(cstack, output)
-					}
-				}
+			val, ok, err := r.lookup(t, cstack)
+			if err != nil {
+				return err
+			}
+			if ok && isLambda(val) {
+				return r.renderSectionLambda(t, val, cstack)
+			} else if ok && !isFalsey(val) {
+				return r.renderSection(t, val, cstack)
 			}
 		} else if t.cmd == "^" {
-			if val, ok := contextStackContains(cstack, t.args); !ok || isFalsey(val) {
-				for _, t := range t.children {
-					t.render(cstack, output)
+			val, ok, err := contextStackContains(cstack, t.args)
+			if err != nil {
+				return r.lookupError(t, err)
+			}
+			if !ok || isFalsey(val) {
+				return r.renderChildren(t.children, cstack)
+			}
+		} else if t.cmd == ">" {
+			name := t.args
+			if t.dynamic {
+				val, ok, err := r.lookup(t, cstack)
+				if err != nil || !ok || isNil(val) {
+					return err
+				}
+				name = fmt.Sprint(val)
+				if s, ok := r.template.partials.(*Set); ok {
+					s.loaded(r.name, name)
 				}
 			}
-		} else if t.cmd == "" {
-			if val, ok := contextStackContains(cstack, t.args); ok {
-				s := fmt.Sprint(val)
+			return r.renderPartial(t, name, cstack)
+		} else if t.cmd == "<" {
+			return r.renderParent(t, cstack)
+		} else if t.cmd == "$" {
+			return r.renderBlock(t, cstack)
+		} else if t.cmd == "" && t.args != "" {
+			val, ok, err := r.lookup(t, cstack)
+			if err != nil {
+				return err
+			}
+			if ok {
+				if fn, ok := val.(func() string); ok {
+					if val, err = r.renderString(fn(), defaultOtag, defaultCtag, cstack); err != nil {
+						return err
+					}
+				}
+				if val, err = r.applyFilters(t, val); err != nil {
+					return err
+				}
+				s := ""
+				if !isNil(val) {
+					s = fmt.Sprint(val)
+				}
 				if !t.notEscaped {
-					s = html.EscapeString(s)
+					s = r.template.escape(s)
+				}
+				if _, err := io.WriteString(r.w, s); err != nil {
+					return err
 				}
-				output.WriteString(s)
-			}
-			for _, child := range t.children {
-				child.render(cstack, output)
 			}
+		} else if t.cmd == "" {
+			return r.renderChildren(t.children, cstack)
 		}
 	} else {
-		output.WriteString(t.args)
+		_, err := io.WriteString(r.w, t.args)
+		return err
+	}
+
+	return nil
+}
+
+// Renderer holds the state of a single render of a template.
+type renderer struct {
+	template *Template
+	name     string // name of the template or partial being rendered
+	w        io.Writer
+	depth    int                 // how many partials deep the current token is
+	blocks   []map[string]*token // block overrides of the enclosing parents, outermost first
+	missing  *MissingKeysError   // keys that were not found, when reporting missing keys
+
+	ctx        context.Context // checked while iterating and including partials, rendering stops once it is done
+	sections   int             // how many sections deep the current token is
+	iterations *int            // how many items sections have iterated over in total
+	output     *limitWriter    // limits the bytes written when the template has a MaxOutput
+}
+
+// Lookup finds the args of the token in the context stack.
+// Keys that can not be found are handled according to the template's MissingKeyMode.
+func (r *renderer) lookup(t *token, cstack []interface{}) (interface{}, bool, error) {
+	val, ok, err := contextStackContains(cstack, t.args)
+	if err != nil {
+		return nil, false, r.lookupError(t, err)
+	}
+	if ok || r.template.missingKeys == IgnoreMissingKeys {
+		return val, ok, nil
+	}
+
+	missing := &MissingKeyError{Name: r.name, Key: t.args, Line: t.line, Column: t.col, Tag: t.tag}
+	if r.template.missingKeys == ErrorOnMissingKeys {
+		return nil, false, missing
+	}
+	*r.missing = append(*r.missing, missing)
+
+	return nil, false, nil
+}
+
+// PanicError converts a value recovered from a panic while rendering the token into an error.
+func (r *renderer) panicError(t *token, p interface{}) error {
+	if err, ok := p.(error); ok {
+		return fmt.Errorf("%s Render error: panic while evaluating %s for %s: %w", position(r.name, t.line, t.col), t.args, t.tag, err)
+	}
+
+	return fmt.Errorf("%s Render error: panic while evaluating %s for %s: %v", position(r.name, t.line, t.col), t.args, t.tag, p)
+}
+
+// LookupError adds the position of the token to an error returned while looking up its args.
+func (r *renderer) lookupError(t *token, err error) error {
+	return fmt.Errorf("%s Render error: %s returned an error for %s: %w", position(r.name, t.line, t.col), t.args, t.tag, err)
+}
+
+// RenderChildren renders each of the tokens in order, stopping at the first error.
+func (r *renderer) renderChildren(children []*token, cstack []interface{}) error {
+	for _, child := range children {
+		if err := child.render(r, cstack); err != nil {
+			return err
+		}
 	}
+
+	return nil
+}
+
+// RenderPartial resolves a partial by name and renders it with the current context stack.
+// Partials that do not exist render nothing, and those outside of the loader's root are errors wrapping ErrPartialOutsideRoot.
+func (r *renderer) renderPartial(t *token, name string, cstack []interface{}) error {
+	if r.depth >= maxPartialDepth {
+		return fmt.Errorf("Render error: %s exceeded the maximum partial depth of %d", name, maxPartialDepth)
+	}
+	if r.ctx != nil {
+		if err := r.ctx.Err(); err != nil {
+			return r.contextError(t, err)
+		}
+	}
+
+	p, err := r.template.partial(name, t.indent)
+	if errors.Is(err, ErrPartialOutsideRoot) {
+		// refused by the loader rather than missing, so it is not reported as a malformed template
+		return fmt.Errorf("%s Render error: partial %s is not allowed for %s: %w", position(r.name, t.line, t.col), name, t.tag, err)
+	}
+	if _, ok := err.(*ParseError); err != nil && !ok {
+		err = &ParseError{Name: r.name, Line: t.line, Column: t.col, Tag: t.tag, Kind: MissingPartial, Msg: fmt.Sprintf("partial %s could not be loaded", name), Err: err}
+	}
+	if err != nil || p == nil {
+		return err
+	}
+
+	parentName := r.name
+	r.name = name
+	r.depth++
+	err = p.render(r, cstack)
+	r.depth--
+	r.name = parentName
+
+	return err
 }
 
 // Compile will take compile a template into a token.
 // The entire compiled template is held by a root token.
 // Sections are represented as children to current token.
-func compile(template string, rootToken *token, buffer *bytes.Buffer, lineTokenPointers []*token) (*token, []*token, error) {
-	var err error
+// Partials are left as tokens and resolved when rendering.
+// The template is read starting with the given delimiters.
+// The first problem found is returned as a *ParseError, the name of the template is used to report it.
+func compile(name, template, otag, ctag string) (*token, error) {
+	var err error                                           // the first error found
+	buffer := &bytes.Buffer{}                               // tag arguments being read, text is sliced from the template
+	rootToken := &token{within: true}                       // holds the entire template
+	lineTokenPointers := make([]*token, 0, 8)               // tokens on the current line, reused for each line
+	block := []token{}                                      // tokens are allocated from blocks rather than one at a time
 	tripleTag, withinTag, notEscaped := false, false, false // booleans that indicate state
-	otag, ctag := defaultOtag, defaultCtag                  // opening and closing tags
 	sections := []*token{rootToken}                         // section stack
+	sectionStarts := []int{0}                               // index where the text of each section in the stack starts
+	tagStart := 0                                           // index where the current tag was opened
+	textStart := 0                                          // index where the text being read started
 	cmd := ""                                               // current command for this token
+	pos := &cursor{template: template, line: 1, col: 1}     // tracks the line and column of tags
+
+	// alloc returns a pointer to a copy of the token, blocks are never grown so that the pointers stay valid
+	alloc := func(tkn token) *token {
+		if len(block) == cap(block) {
+			block = make([]token, 0, 64)
+		}
+		block = append(block, tkn)
+		return &block[len(block)-1]
+	}
+
+	// fail records the first error found, positioned at the given tag
+	fail := func(tkn *token, kind ErrorKind, msg string) {
+		if err == nil {
+			err = &ParseError{Name: name, Line: tkn.line, Column: tkn.col, Tag: tkn.tag, Kind: kind, Msg: msg}
+		}
+	}
 
+	// the template is scanned a byte at a time, which is safe for utf-8 since every byte of a multibyte
+	// character is above the ascii range used for commands and whitespace, and delimiters are matched as strings.
+	// Text is sliced from the template rather than copied, so scanning it does not allocate.
 	for i := 0; i < len(template); i++ {
-		s := string(template[i])
+		c := template[i]
 		if withinTag {
 			if tripleTag && matchesTag(template, i, "}}}") {
 				tripleTag, withinTag = false, false
@@ -126,93 +297,116 @@ func compile(template string, rootToken *token, buffer *bytes.Buffer, lineTokenP
 			} else if matchesTag(template, i, ctag) {
 				withinTag = false
 				i += len(ctag) - 1
-			} else if _, ok := commands[s]; ok && cmd == "" {
-				cmd = s
-			} else if !isWhiteSpace(s) || cmd == "=" {
-				buffer.WriteString(s)
+			} else if strings.IndexByte(commands, c) >= 0 && cmd == "" {
+				cmd = template[i : i+1]
+			} else if !isWhiteSpace(c) || cmd == "=" {
+				buffer.WriteByte(c)
 			}
 			// we just closed the tag, we should evaluate it
 			if !withinTag {
-				var currentToken token
-				currentToken, err = newToken(cmd, buffer, true, notEscaped)
-				lineTokenPointers = append(lineTokenPointers, &currentToken)
+				tagToken, _ := newToken(cmd, buffer, true, notEscaped)
+				currentToken := alloc(tagToken)
+				currentToken.tag = template[tagStart : i+1]
+				currentToken.otag, currentToken.ctag = otag, ctag
+				currentToken.line, currentToken.col = pos.position(tagStart)
+				if currentToken.cmd == ">" && strings.HasPrefix(currentToken.args, "*") {
+					currentToken.args, currentToken.dynamic = currentToken.args[1:], true
+				}
+				lineTokenPointers = append(lineTokenPointers, currentToken)
 				notEscaped = false
 				cmd = ""
+				textStart = i + 1
 
 				if currentToken.cmd == "/" {
-					if len(sections) > 0 && sections[len(sections)-1].args == currentToken.args {
+					if len(sections) > 1 && sections[len(sections)-1].args == currentToken.args {
+						sections[len(sections)-1].text = template[sectionStarts[len(sections)-1]:tagStart]
 						sections = sections[:len(sections)-1]
-						lineTokenPointers = addTokenToLastToken(&currentToken, lineTokenPointers, sections)
+						sectionStarts = sectionStarts[:len(sectionStarts)-1]
+						lineTokenPointers = addTokenToLastToken(currentToken, lineTokenPointers, sections)
+					} else if len(sections) > 1 {
+						fail(currentToken, MismatchedClose, fmt.Sprintf("%s was closed but %s is open", currentToken.args, sections[len(sections)-1].args))
 					} else {
-						err = fmt.Errorf("Malformed template: %s was closed but not opened", currentToken.args)
-					}
-				} else if currentToken.cmd == ">" {
-					b, err := ioutil.ReadFile(currentToken.args + ".mustache")
-
-					if err == nil {
-						_, lineTokenPointers, err = compile(string(b), sections[len(sections)-1], buffer, lineTokenPointers)
+						fail(currentToken, MismatchedClose, fmt.Sprintf("%s was closed but not opened", currentToken.args))
 					}
-				} else if currentToken.cmd == "=" {
-					otag, ctag = parseDelimiters(currentToken.args)
 				} else {
 					lastToken := sections[len(sections)-1]
-					lastToken.children = append(lastToken.children, &currentToken)
+					lastToken.children = append(lastToken.children, currentToken)
 
-					if currentToken.cmd == "#" || currentToken.cmd == "^" {
-						sections = append(sections, &currentToken)
+					if currentToken.cmd == "=" {
+						if o, c, delimErr := parseDelimiters(currentToken.args); delimErr != nil {
+							fail(currentToken, BadDelimiter, delimErr.Error())
+						} else {
+							otag, ctag = o, c
+						}
+					} else if currentToken.cmd == "#" || currentToken.cmd == "^" || currentToken.cmd == "<" || currentToken.cmd == "$" {
+						sections = append(sections, currentToken)
+						sectionStarts = append(sectionStarts, i+1)
 					}
 				}
 			}
 		} else {
 			if matchesTag(template, i, "{{{") {
 				tripleTag, withinTag = true, true
+				tagStart = i
 				i += 2
 			} else if matchesTag(template, i, otag) {
 				withinTag = true
+				tagStart = i
 				i += len(otag) - 1
 			} else {
 				// lines are valid if they contain actual values on them,
 				// just a section should not make a newline to the final output
 				// hwowever, a line with just whitespace or a single newline is valid
-				if isNewLine(s) {
-					if !shouldKeepWhiteSpace(lineTokenPointers, buffer) {
-						cleanWhiteSpaceOnPastTokens(lineTokenPointers)
+				if isNewLine(c) {
+					text := template[textStart : i+1]
+					if !shouldKeepWhiteSpace(lineTokenPointers, template[textStart:i]) {
 						// handle windows carriage returns
 						if matchesTag(template, i, "\r\n") {
 							i++
 						}
-						buffer.Reset()
-					} else {
-						buffer.WriteString(s)
+						cleanWhiteSpaceOnPastTokens(lineTokenPointers, template[i+1:])
+						text = ""
 					}
-					lineTokenPointers = []*token{}
-					currentToken, _ := newToken("", buffer, false, true)
-					addTokenToLastToken(&currentToken, lineTokenPointers, sections)
-				} else {
-					buffer.WriteString(s)
+					lineTokenPointers = lineTokenPointers[:0]
+					currentToken := alloc(token{args: text, notEscaped: true})
+					currentToken.line, currentToken.col = pos.position(textStart)
+					addTokenToLastToken(currentToken, lineTokenPointers, sections)
+					textStart = i + 1
 				}
 			}
 			// we just opened it so set state
 			if withinTag {
-				var currentToken token
-				currentToken, err = newToken(cmd, buffer, false, false)
-				lineTokenPointers = addTokenToLastToken(&currentToken, lineTokenPointers, sections)
+				currentToken := alloc(token{args: template[textStart:tagStart]})
+				currentToken.line, currentToken.col = pos.position(textStart)
+				lineTokenPointers = addTokenToLastToken(currentToken, lineTokenPointers, sections)
 			}
 		}
 	}
 
-	if !shouldKeepWhiteSpace(lineTokenPointers, buffer) {
-		cleanWhiteSpaceOnPastTokens(lineTokenPointers)
-		buffer.Reset()
+	if withinTag {
+		unclosed := token{tag: template[tagStart:]}
+		unclosed.line, unclosed.col = pos.position(tagStart)
+		fail(&unclosed, UnclosedTag, fmt.Sprintf("%s was not closed", strings.TrimSpace(unclosed.tag)))
+		cmd = ""
+	}
+
+	// the arguments of an unclosed tag are left as text
+	text := template[textStart:]
+	if withinTag {
+		text = buffer.String()
 	}
-	var currentToken token
-	currentToken, err = newToken(cmd, buffer, false, false)
-	addTokenToLastToken(&currentToken, lineTokenPointers, sections)
+	if !shouldKeepWhiteSpace(lineTokenPointers, text) {
+		cleanWhiteSpaceOnPastTokens(lineTokenPointers, "")
+		text = ""
+	}
+	currentToken := alloc(token{args: text})
+	currentToken.line, currentToken.col = pos.position(textStart)
+	addTokenToLastToken(currentToken, lineTokenPointers, sections)
 
 	if len(sections) > 1 {
-		err = fmt.Errorf("Malformed template: %s was not closed", sections[len(sections)-1].args)
+		fail(sections[len(sections)-1], UnclosedSection, fmt.Sprintf("%s was not closed", sections[len(sections)-1].args))
 	}
-	return rootToken, lineTokenPointers, err
+	return rootToken, err
 }
 
 func addTokenToLastToken(tkn *token, lineTokenPointers []*token, sections []*token) []*token {
@@ -224,11 +418,48 @@ func addTokenToLastToken(tkn *token, lineTokenPointers []*token, sections []*tok
 	return append(lineTokenPointers, tkn)
 }
 
-func cleanWhiteSpaceOnPastTokens(lineTokenPointers []*token) {
-	// clear out whitespace
+// CleanWhiteSpaceOnPastTokens clears out the whitespace of a standalone line, keeping what was before a standalone
+// partial or parent as its indentation. The rest of the template, which follows the line, gives the indentation
+// of the content of the blocks opened on the line.
+func cleanWhiteSpaceOnPastTokens(lineTokenPointers []*token, rest string) {
+	indent := ""
+	var partial *token
+	var blocks []*token
+	tags := 0
 	for _, tkn := range lineTokenPointers {
 		if tkn.cmd == "" && !tkn.within {
+			if tags == 0 {
+				indent += tkn.args
+			}
 			tkn.args = ""
+		} else if tkn.cmd == "/" && partial != nil && partial.cmd == "<" && partial.args == tkn.args {
+			// a parent closed on the line it is opened on is still standalone
+		} else {
+			tags++
+			switch tkn.cmd {
+			case ">", "<":
+				partial = tkn
+			case "$":
+				blocks = append(blocks, tkn)
+			}
+		}
+	}
+	if partial != nil && tags == 1 {
+		partial.indent = indent
+	}
+
+	// the content of a block is indented as its first line, or as the tag if the block is closed on the same line
+	next := rest[:len(rest)-len(strings.TrimLeft(rest, " \t"))]
+	for _, block := range blocks {
+		block.indent = next
+	}
+	for _, tkn := range lineTokenPointers {
+		if tkn.cmd == "/" {
+			for _, block := range blocks {
+				if block.args == tkn.args {
+					block.indent = indent
+				}
+			}
 		}
 	}
 }
@@ -238,8 +469,8 @@ func cleanWhiteSpaceOnPastTokens(lineTokenPointers []*token) {
 // Whitespace should be removed if the line is only there for making a template legible as a template
 // but is not desired for the final output.
 // i.e. - in lines that only contain {{/foo}}, then the line should not introduce additional whitespace
-func shouldKeepWhiteSpace(lineTokenPointers []*token, buffer *bytes.Buffer) bool {
-	if !isStringCompletelyWhiteSpace(buffer.String()) || len(lineTokenPointers) == 0 {
+func shouldKeepWhiteSpace(lineTokenPointers []*token, text string) bool {
+	if !isStringCompletelyWhiteSpace(text) || len(lineTokenPointers) == 0 {
 		return true
 	}
 
@@ -253,22 +484,22 @@ func shouldKeepWhiteSpace(lineTokenPointers []*token, buffer *bytes.Buffer) bool
 }
 
 func isStringCompletelyWhiteSpace(s string) bool {
-	for _, chr := range s {
-		if !isWhiteSpace(string(chr)) {
+	for i := 0; i < len(s); i++ {
+		if !isWhiteSpace(s[i]) {
 			return false
 		}
 	}
 	return true
 }
 
-// IsWhiteSpace returns a boolean indicating if this character is a whitespace
-func isWhiteSpace(chr string) bool {
-	return chr == "" || chr == " " || chr == "\t" || isNewLine(chr) || rune(chr[0]) < 32
+// IsWhiteSpace returns a boolean indicating if this byte is whitespace or a control character
+func isWhiteSpace(c byte) bool {
+	return c == ' ' || c == '\t' || isNewLine(c) || c < 32
 }
 
-// IsNewLine returns a boolean indicating if this character is a newline character
-func isNewLine(chr string) bool {
-	return chr == "\n" || chr == "\r"
+// IsNewLine returns a boolean indicating if this byte is a newline character
+func isNewLine(c byte) bool {
+	return c == '\n' || c == '\r'
 }
 
 // MatchesTag looks ahead to see if the given tag is found at the given position in a template.
@@ -279,7 +510,7 @@ func matchesTag(template string, i int, tag string) bool {
 }
 
 // ParseDelimiters parses a delimiter command and returns the opening and closing tags
-func parseDelimiters(args string) (string, string) {
+func parseDelimiters(args string) (string, string, error) {
 	var splitArgs []string
 	for _, e := range strings.Split(args, " ") {
 		e = strings.Replace(e, "=", "", -1)
@@ -288,7 +519,11 @@ func parseDelimiters(args string) (string, string) {
 		}
 	}
 
-	return splitArgs[0], splitArgs[len(splitArgs)-1]
+	if len(splitArgs) != 2 {
+		return "", "", fmt.Errorf("delimiters %q should be an opening and closing tag separated by a space", strings.TrimSuffix(args, "="))
+	}
+
+	return splitArgs[0], splitArgs[1], nil
 }
 
 // NewToken is a constructor for token and will return a new token based on several parameters.
@@ -315,38 +550,64 @@ func newToken(cmd string, b *bytes.Buffer, within, notEscaped bool) (token, erro
 }
 
 // IsFalsey returns a boolean indicating whether the value is "falsey"
+// Nil values and nil pointers are falsey, otherwise the value a pointer points to is checked.
 func isFalsey(val interface{}) bool {
-	v := reflect.ValueOf(val)
-	switch reflect.TypeOf(val).Kind() {
+	if isNil(val) {
+		return true
+	}
+
+	v := indirect(reflect.ValueOf(val))
+	switch v.Kind() {
 	case reflect.Array, reflect.Slice, reflect.Map:
 		return v.Len() == 0
 	case reflect.Bool:
 		return !v.Bool()
 	default:
-		return fmt.Sprint(val) == ""
+		return fmt.Sprint(v.Interface()) == ""
 	}
 }
 
+// IsNil returns a boolean indicating whether the value is nil or a nil pointer, map, slice, func or channel.
+func isNil(val interface{}) bool {
+	v := reflect.ValueOf(val)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return true
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return v.IsNil()
+	}
+
+	return false
+}
+
+// Indirect dereferences pointers and interfaces until a value is found.
+func indirect(v reflect.Value) reflect.Value {
+	for (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	return v
+}
+
 // ContextStackContains recursively walks the context stack to see if the given key is available.
-// It will return the value and an ok.
-func contextStackContains(cstack []interface{}, key string) (interface{}, bool) {
+// It will return the value and an ok, or an error if a method called to look up the key failed.
+func contextStackContains(cstack []interface{}, key string) (interface{}, bool, error) {
 	for i := len(cstack) - 1; i >= 0; i-- {
 		c := cstack[i]
 
 		if key == "." {
-			return c, true
+			return c, true, nil
 		}
 
-		k := reflect.TypeOf(c).Kind()
-		v := reflect.ValueOf(c)
-		if k == reflect.Map {
-			if val := v.MapIndex(reflect.ValueOf(key)); val.IsValid() {
-				return val.Interface(), true
-			}
-		} else if k == reflect.Struct {
-			if val := v.FieldByName(key); val.IsValid() {
-				return val.Interface(), true
-			}
+		if val, ok, err := lookupKey(c, key); ok || err != nil {
+			return val, ok, err
 		}
 	}
 	// a solitary "." is the implicit operator
@@ -356,49 +617,274 @@ func contextStackContains(cstack []interface{}, key string) (interface{}, bool)
 		var r interface{}
 		for _, prefix := range s {
 			var ok bool
-			r, ok = contextStackContains(searchstack, prefix)
+			var err error
+			r, ok, err = contextStackContains(searchstack, prefix)
 			searchstack = []interface{}{r}
-			if !ok {
-				return nil, false
+			if !ok || err != nil {
+				return nil, false, err
 			}
 		}
-		return r, true
+		return r, true, nil
 	}
 
-	return nil, false
+	return nil, false, nil
 }
 
 // Template is a compiled template
 type Template struct {
-	token *token
+	token    *token
+	name     string              // name of the template, used when reporting errors
+	partials PartialLoader       // loader used to resolve {{> name}} tags
+	escape   func(string) string // escapes interpolated values
+
+	missingKeys       MissingKeyMode        // how keys that are not found are handled
+	iterationMetadata bool                  // whether @index and friends are available when iterating
+	iterateAll        bool                  // whether channels and iterator functions are iterated over
+	iterateMaps       map[reflect.Type]bool // the types of maps that are iterated over
+	filters           FuncMap               // filters that can be applied to interpolated values
+
+	maxDepth      int   // the maximum nesting of sections, 0 for no limit
+	maxIterations int   // the maximum number of items iterated over in a render, 0 for no limit
+	maxOutput     int64 // the maximum number of bytes written by a render, 0 for no limit
+
+	mu    sync.Mutex
+	cache map[partialKey]*token // compiled partials, nil if the partial does not exist
+}
+
+// PartialKey identifies a compiled partial by its name and the indentation of the standalone tag including it.
+type partialKey struct {
+	name, indent string
+}
+
+// IndentLines prefixes each line of the source of a standalone partial with the indentation of its tag.
+func indentLines(src, indent string) string {
+	if indent == "" {
+		return src
+	}
+
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(src, "\n") {
+		if line != "" {
+			b.WriteString(indent)
+			b.WriteString(line)
+		}
+	}
+
+	return b.String()
+}
+
+// Option configures how a template is compiled and rendered.
+type Option func(*Template)
+
+// Partials sets the loader used to resolve partials.
+// By default partials are read from name + ".mustache" relative to the working directory.
+func Partials(loader PartialLoader) Option {
+	return func(t *Template) {
+		t.partials = loader
+	}
+}
+
+// Name sets the name of the template, which is used when reporting errors.
+func Name(name string) Option {
+	return func(t *Template) {
+		t.name = name
+	}
+}
+
+// Escape sets the function used to escape interpolated values, such as EscapeJSON or EscapeNone.
+// Values in triple mustaches and {{& name}} tags are not escaped. By default, or if the escaper is nil,
+// values are escaped with EscapeHTML.
+func Escape(escaper func(string) string) Option {
+	return func(t *Template) {
+		if escaper == nil {
+			escaper = EscapeHTML
+		}
+		t.escape = escaper
+	}
+}
+
+// MissingKeyMode controls how names that can not be found in the context are handled
+// by interpolations and sections. Inverted sections are not affected since they are
+// commonly used to check that a name is not present.
+type MissingKeyMode int
+
+const (
+	IgnoreMissingKeys  MissingKeyMode = iota // missing keys render nothing, this is the default
+	ErrorOnMissingKeys                       // rendering stops and a *MissingKeyError is returned
+	ReportMissingKeys                        // missing keys render nothing and are returned as a MissingKeysError once rendering completes
+)
+
+// MissingKeys sets how names that can not be found in the context are handled.
+func MissingKeys(mode MissingKeyMode) Option {
+	return func(t *Template) {
+		t.missingKeys = mode
+	}
+}
+
+// IterationMetadata makes the following keys available within sections that iterate over a list
+//
+//	@index   the index of the current item, starting at 0
+//	@index1  the index of the current item, starting at 1
+//	@first   true for the first item
+//	@last    true for the last item
+//	@length  the number of items, which is not available for channels and iterator functions
+//
+// i.e. - {{#items}}{{name}}{{^@last}}, {{/@last}}{{/items}}
+func IterationMetadata() Option {
+	return func(t *Template) {
+		t.iterationMetadata = true
+	}
+}
+
+// IterateAll makes sections iterate over channels and iterator functions as well as lists,
+// and over maps of the types of the given values, i.e. - IterateAll(map[string]int(nil)).
+//
+// Map entries are iterated in order of their keys, with the key available as @key and the value as
+// the context. Maps of other types, such as the objects decoded from JSON, are still used as the
+// context of a section. Channels are received from until they are closed. Functions of the form of
+// iter.Seq are ranged over, as are iter.Seq2 functions with the first value available as @key.
+//
+// Without this option maps are used as the context of a section and channels and functions are not iterated.
+func IterateAll(maps ...interface{}) Option {
+	return func(t *Template) {
+		t.iterateAll = true
+		for _, m := range maps {
+			if t.iterateMaps == nil {
+				t.iterateMaps = make(map[reflect.Type]bool)
+			}
+			t.iterateMaps[reflect.TypeOf(m)] = true
+		}
+	}
+}
+
+// Filters enables filters, which are applied to interpolated values with a pipe, i.e. - {{ price | currency }}.
+// Filters are applied in order before the value is escaped. Compiling a template that uses a filter
+// that is not in the map returns a *ParseError.
+func Filters(funcs FuncMap) Option {
+	return func(t *Template) {
+		t.filters = funcs
+	}
 }
 
 // Compile will compile a template. Compiled templates are faster if you use them more then once,
-// otherwise prefer Render.
-func Compile(template string) (*Template, error) {
-	var b bytes.Buffer
-	t, _, err := compile(template, &token{within: true}, &b, []*token{})
+// otherwise prefer Render. No template is returned if the options are invalid.
+func Compile(template string, opts ...Option) (*Template, error) {
+	t := &Template{partials: DirLoader(""), escape: EscapeHTML}
+	for _, opt := range opts {
+		opt(t)
+	}
+	if err := t.filters.validate(); err != nil {
+		return nil, err
+	}
+
+	var err error
+	t.token, err = t.compile(t.name, template, defaultOtag, defaultCtag)
+
+	return t, err
+}
+
+// Compile compiles a template, or a partial or lambda used by it, with the options of the template.
+func (t *Template) compile(name, template, otag, ctag string) (*token, error) {
+	root, err := compile(name, template, otag, ctag)
+	if err == nil && t.filters != nil {
+		err = parseFilters(name, root, t.filters)
+	}
 
-	return &Template{t}, err
+	return root, err
+}
+
+// Partial returns the compiled partial for the given name with each line indented, loading and compiling
+// it on first use. A nil token is returned if the partial does not exist.
+func (t *Template) partial(name, indent string) (*token, error) {
+	// templates in a set are already compiled and may be replaced, so use them directly
+	if set, ok := t.partials.(*Set); ok {
+		return set.partial(name, indent)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := partialKey{name, indent}
+	if p, ok := t.cache[key]; ok {
+		return p, nil
+	}
+
+	src, err := t.partials.Load(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		src, err = "", nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var p *token
+	if src != "" {
+		if p, err = t.compile(name, indentLines(src, indent), defaultOtag, defaultCtag); err != nil {
+			return nil, err
+		}
+	}
+
+	if t.cache == nil {
+		t.cache = make(map[partialKey]*token)
+	}
+	t.cache[key] = p
+
+	return p, nil
 }
 
 // Render will render a template using the provided data.
+// Errors are discarded, use Execute if they need to be handled.
 func (t *Template) Render(c ...interface{}) string {
 	var b bytes.Buffer
-	t.token.render(c, &b)
+	t.Execute(&b, c...)
 
 	return b.String()
 }
 
+// Execute will render a template using the provided data and write the output to w.
+// Output is streamed as it is rendered, so w may receive partial output if an error occurs.
+func (t *Template) Execute(w io.Writer, c ...interface{}) error {
+	return t.ExecuteContext(context.Background(), w, c...)
+}
+
+// ExecuteContext is like Execute, but stops rendering with the error of the context once it is done.
+// The context is checked before each item of a section is rendered, before each partial and parent is included
+// and while waiting to receive from a channel.
+func (t *Template) ExecuteContext(ctx context.Context, w io.Writer, c ...interface{}) error {
+	r := &renderer{template: t, name: t.name, w: w, missing: &MissingKeysError{}, ctx: ctx, iterations: new(int)}
+	if t.maxOutput > 0 {
+		r.output = &limitWriter{w: w, max: t.maxOutput}
+		r.w = r.output
+	}
+	if err := t.token.render(r, c); err != nil {
+		return err
+	}
+	if len(*r.missing) > 0 {
+		return *r.missing
+	}
+
+	return nil
+}
+
 // Render will render a template using the provided data.
+// Errors from compiling the template take precedence over errors from rendering it.
 func Render(template string, c ...interface{}) (string, error) {
 	t, err := Compile(template)
 
-	s := t.Render(c...)
+	var b bytes.Buffer
+	if renderErr := t.Execute(&b, c...); err == nil {
+		err = renderErr
+	}
 
+	return b.String(), err
+}
+
+// RenderTo will render a template using the provided data and write the output to w.
+func RenderTo(w io.Writer, template string, c ...interface{}) error {
+	t, err := Compile(template)
 	if err != nil {
-		return s, err
+		return err
 	}
 
-	return s, nil
+	return t.Execute(w, c...)
 }
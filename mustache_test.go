@@ -2,6 +2,8 @@ package mustache
 
 import (
 	"bytes"
+	"errors"
+	"strings"
 	"testing"
 )
 
@@ -45,7 +47,7 @@ func TestCompile(t *testing.T) {
 
 func TestCompileSetTag(t *testing.T) {
 	template, _ := Compile("{{=<% %>=}}<% erb_style_tags %><%={{ }}=%>{{test}}")
-	expected := []string{"erb_style_tags", "test"}
+	expected := []string{"<% %>=", "erb_style_tags", "{{ }}=", "test"}
 
 	for i, e := range expected {
 		if template.token.children[i].args != e {
@@ -67,13 +69,17 @@ func TestCompileComments(t *testing.T) {
 
 func TestCompilePartial(t *testing.T) {
 	template, _ := Compile("{{name}}{{> test-assets/partial }}")
-	expected := []string{"name", "foo"}
+	expected := []string{"name", "test-assets/partial"}
 
 	for i, e := range expected {
 		if template.token.children[i].args != e {
 			t.Errorf("Invalid arguments while parsing, expected %s but got %s", e, template.token.children[i].args)
 		}
 	}
+
+	if cmd := template.token.children[1].cmd; cmd != ">" {
+		t.Errorf("Invalid command while parsing, expected > but got %s", cmd)
+	}
 }
 
 func TestCompileSection(t *testing.T) {
@@ -126,6 +132,10 @@ func TestRender(t *testing.T) {
 		expects{"{{num}} / {{dem}}", map[string]int{"num": 1, "dem": 10}, "1 / 10"},
 		expects{"{{Foo}}", foo{"bar", 10}, "bar"},
 		expects{"{{foo}}", foo{"bar", 10}, ""},
+		expects{"héllo {{name}} «日本»\n", map[string]string{"name": "wörld"}, "héllo wörld «日本»\n"},
+		expects{"{{=« »=}}«name» é «#list»«.»«/list»", map[string]interface{}{"name": "ñ", "list": []string{"ü", "ß"}}, "ñ é üß"},
+		expects{"{{=«« »»=}}««#lambda»»x ««name»»««/lambda»»", map[string]interface{}{"name": "ñ", "lambda": func(s string) string { return "<" + s + ">" }}, "<x ñ>"},
+		expects{"{{ nämé }} {{#ö}}{{.}}{{/ö}}", map[string]interface{}{"nämé": "ok", "ö": []int{1, 2}}, "ok 12"},
 	}
 
 	for _, e := range expected {
@@ -135,6 +145,122 @@ func TestRender(t *testing.T) {
 	}
 }
 
+func TestExecute(t *testing.T) {
+	template, _ := Compile("hello {{name}}{{#list}}, {{.}}{{/list}}")
+
+	var b bytes.Buffer
+	if err := template.Execute(&b, map[string]interface{}{"name": "steve", "list": []int{1, 2}}); err != nil {
+		t.Errorf("Unexpected error while executing, %s", err)
+	}
+	if b.String() != "hello steve, 1, 2" {
+		t.Errorf("Incorrect executed template, got %s, expected %s", b.String(), "hello steve, 1, 2")
+	}
+
+	b.Reset()
+	if err := RenderTo(&b, "{{a}} and {{b}}", map[string]string{"a": "x", "b": "y"}); err != nil || b.String() != "x and y" {
+		t.Errorf("Incorrect RenderTo output, got %s and %v", b.String(), err)
+	}
+}
+
+// Render executes the template with the data, returning the output along with the error.
+func render(t *Template, data interface{}) (string, error) {
+	var b strings.Builder
+	err := t.Execute(&b, data)
+
+	return b.String(), err
+}
+
+type failingWriter struct {
+	n int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.n == 0 {
+		return 0, errors.New("write failed")
+	}
+	w.n--
+	return len(p), nil
+}
+
+func TestExecuteWriteError(t *testing.T) {
+	template, _ := Compile("a{{#list}}{{.}}{{/list}}b")
+
+	w := &failingWriter{n: 2}
+	if err := template.Execute(w, map[string]interface{}{"list": []int{1, 2, 3}}); err == nil || err.Error() != "write failed" {
+		t.Errorf("Expected the write error to be returned, got %v", err)
+	}
+}
+
+func TestRenderNil(t *testing.T) {
+	type expects struct {
+		template string
+		context  interface{}
+		expected string
+	}
+
+	var nilPointer *struct{ Name string }
+
+	expected := [...]expects{
+		expects{"I ({{cannot}}) be seen!", map[string]interface{}{"cannot": nil}, "I () be seen!"},
+		expects{"{{#a}}yes{{/a}}{{^a}}no{{/a}}", map[string]interface{}{"a": nil}, "no"},
+		expects{"{{#a}}yes{{/a}}{{^a}}no{{/a}}{{a.Name}}", map[string]interface{}{"a": nilPointer}, "no"},
+		expects{"{{#list}}({{.}}){{/list}}", map[string]interface{}{"list": []interface{}{nil, 1}}, "()(1)"},
+		expects{"{{a}}{{b.c}}", nil, ""},
+	}
+
+	for _, e := range expected {
+		if r, err := Render(e.template, e.context); r != e.expected || err != nil {
+			t.Errorf("Incorrect rendered template, got %s and %v, expected %s", r, err, e.expected)
+		}
+	}
+}
+
+func TestRenderPanic(t *testing.T) {
+	template, _ := Compile("hello\n{{#list}}{{explode}}{{/list}}", Name("page"))
+
+	var b bytes.Buffer
+	err := template.Execute(&b, map[string]interface{}{
+		"list":    []int{1},
+		"explode": func() string { panic("boom") },
+	})
+	if err == nil || err.Error() != "page:2:10: Render error: panic while evaluating explode for {{explode}}: boom" {
+		t.Errorf("Expected the panic to be returned as an error, got %v", err)
+	}
+
+	if _, err := Render("{{a}}", map[string]interface{}{"a": func() string { panic(errors.New("failed")) }}); err == nil {
+		t.Errorf("Expected the panic to be returned as an error")
+	}
+}
+
+func TestIterationMetadata(t *testing.T) {
+	data := map[string]interface{}{
+		"items":  []string{"a", "b", "c"},
+		"nested": [][]int{{1, 2}, {3}},
+	}
+
+	type expects struct {
+		template string
+		expected string
+	}
+
+	expected := [...]expects{
+		expects{"{{#items}}{{.}}{{^@last}}, {{/@last}}{{/items}}", "a, b, c"},
+		expects{"{{#items}}{{@index1}}/{{@length}}:{{.}}{{#@first}}!{{/@first}} {{/items}}", "1/3:a! 2/3:b 3/3:c "},
+		expects{"{{#nested}}[{{@index}}{{#.}} {{@index}}.{{.}}{{/.}}]{{/nested}}", "[0 0.1 1.2][1 0.3]"},
+	}
+
+	for _, e := range expected {
+		template, _ := Compile(e.template, IterationMetadata())
+		if r := template.Render(data); r != e.expected {
+			t.Errorf("Incorrect rendered template, got %s, expected %s", r, e.expected)
+		}
+	}
+
+	if r, _ := Render("{{#items}}{{@index}}{{.}}{{/items}}", data); r != "abc" {
+		t.Errorf("Expected no iteration metadata by default, got %s", r)
+	}
+}
+
 func TestContextStackContains(t *testing.T) {
 	m := map[string]map[string]string{
 		"a":   {"b": "ab"},
@@ -154,7 +280,7 @@ func TestContextStackContains(t *testing.T) {
 	}
 
 	for _, e := range expected {
-		_, ok := contextStackContains([]interface{}{m}, e.key)
+		_, ok, _ := contextStackContains([]interface{}{m}, e.key)
 		if ok != e.valid {
 			t.Errorf("Incorrect contextStackContains, got %t, expected %t for key %v", ok, e.valid, e.key)
 		}
@@ -162,11 +288,16 @@ func TestContextStackContains(t *testing.T) {
 }
 
 func TestIsFalsey(t *testing.T) {
+	var nilPointer *struct{ Name string }
+
 	a := [...]interface{}{
 		false,
 		"",
 		[]string{},
 		map[string]int{},
+		nil,
+		nilPointer,
+		[]string(nil),
 	}
 
 	for _, e := range a {
@@ -226,9 +357,8 @@ func TestShouldKeepWhiteSpace(t *testing.T) {
 		expect{[]*token{&closed, &newLine}, false, "closed, newLine"},
 	}
 
-	var b bytes.Buffer
 	for _, e := range a {
-		if shouldKeepWhiteSpace(e.pointers, &b) != e.expected {
+		if shouldKeepWhiteSpace(e.pointers, "") != e.expected {
 			t.Errorf("Unexpected value for %s", e.desc)
 		}
 	}
@@ -290,8 +420,92 @@ func TestParseDelimiters(t *testing.T) {
 	}
 
 	for _, ex := range e {
-		if otag, ctag := parseDelimiters(ex.args); otag != ex.otag || ctag != ex.ctag {
+		if otag, ctag, err := parseDelimiters(ex.args); otag != ex.otag || ctag != ex.ctag || err != nil {
 			t.Errorf("Unable to find the correct delimiters. expected %s and %s but received %s and %s", ex.otag, ex.ctag, otag, ctag)
 		}
 	}
+
+	for _, args := range [...]string{"=", "<%=", "<% %> %%="} {
+		if _, _, err := parseDelimiters(args); err == nil {
+			t.Errorf("Expected an error for the invalid delimiters %q", args)
+		}
+	}
+}
+
+func TestCompileTextAllocs(t *testing.T) {
+	allocs := func(src string) float64 {
+		return testing.AllocsPerRun(10, func() {
+			Compile(src)
+		})
+	}
+
+	// scanning a run of text does not allocate, however long it is
+	short := allocs("Héllo «wörld»")
+	if long := allocs(strings.Repeat("Héllo «wörld» ", 1<<12)); long != short {
+		t.Errorf("Expected a long run of text to allocate as much as a short one, got %v and %v", long, short)
+	}
+
+	// lines of text share the allocations of their tokens
+	if lines := allocs(strings.Repeat("Héllo «wörld»\n", 1<<10)); lines > short+(1<<10)/32 {
+		t.Errorf("Expected lines of text to allocate their tokens together, got %v allocations for %d lines", lines, 1<<10)
+	}
+}
+
+// largeTemplate returns a template of roughly n bytes mixing text, multibyte text, sections, partials and standalone lines.
+func largeTemplate(n int) string {
+	const chunk = "<li class=\"item\">Héllo, {{name}}! «{{{title}}}» — 日本語のテキスト</li>\n" +
+		"{{#items}}\n  <span>{{label}} costs {{price}}</span>\n{{/items}}\n" +
+		"{{^empty}}none{{/empty}} {{! a comment }} {{> row}}\n"
+
+	var b strings.Builder
+	for b.Len() < n {
+		b.WriteString(chunk)
+	}
+
+	return b.String()
+}
+
+func BenchmarkCompileLarge(b *testing.B) {
+	src := largeTemplate(1 << 20)
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := Compile(src); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCompileText(b *testing.B) {
+	src := strings.Repeat("Plain text with ünïcödé and no tags at all.\n", 1<<14)
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := Compile(src); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRenderLarge(b *testing.B) {
+	template, err := Compile(largeTemplate(1<<18), Partials(MapLoader{"row": "<tr>{{name}}</tr>"}))
+	if err != nil {
+		b.Fatal(err)
+	}
+	data := map[string]interface{}{
+		"name":  "world",
+		"title": "<b>title</b>",
+		"items": []map[string]interface{}{{"label": "a", "price": 1}, {"label": "b", "price": 2.5}},
+	}
+
+	var buf bytes.Buffer
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		if err := template.Execute(&buf, data); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.SetBytes(int64(buf.Len()))
 }
@@ -0,0 +1,116 @@
+package mustache
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ErrPartialOutsideRoot is returned, wrapped in a *fs.PathError, when the name of a partial refers to
+// a file outside of the directory or file system it is loaded from, such as with .., an absolute path
+// or a symlink that leads out of the directory.
+var ErrPartialOutsideRoot = errors.New("partial is outside of the root")
+
+// PartialLoader resolves the source of a partial given the name used in a {{> name}} tag.
+// Loaders should return an error wrapping fs.ErrNotExist when a partial does not exist.
+type PartialLoader interface {
+	Load(name string) (string, error)
+}
+
+// DirLoader loads partials from files named name + ".mustache" relative to the directory,
+// or the working directory if it is empty. Partials are confined to the directory, names that
+// lead outside of it return ErrPartialOutsideRoot.
+type DirLoader string
+
+// Load reads the partial from disk.
+func (d DirLoader) Load(name string) (string, error) {
+	file := filepath.FromSlash(name + ".mustache")
+	if !filepath.IsLocal(file) {
+		return "", &fs.PathError{Op: "load", Path: name, Err: ErrPartialOutsideRoot}
+	}
+
+	dir := string(d)
+	if dir == "" {
+		dir = "."
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return "", err
+	}
+	defer root.Close()
+
+	f, err := root.Open(file)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) && escapes(dir, file) {
+			err = &fs.PathError{Op: "load", Path: name, Err: ErrPartialOutsideRoot}
+		}
+		return "", err
+	}
+	defer f.Close()
+
+	b, err := io.ReadAll(f)
+
+	return string(b), err
+}
+
+// Escapes returns a boolean indicating if the local path within dir resolves to a file outside of dir through a symlink.
+func escapes(dir, file string) bool {
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return false
+	}
+	target, err := filepath.EvalSymlinks(filepath.Join(dir, file))
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(root, target)
+
+	return err != nil || !filepath.IsLocal(rel)
+}
+
+// UnsafeDirLoader loads partials from files named name + ".mustache" relative to the directory,
+// without confining them to it. Templates using it can read any file ending in .mustache,
+// so it should only be used with templates that are trusted.
+type UnsafeDirLoader string
+
+// Load reads the partial from disk.
+func (d UnsafeDirLoader) Load(name string) (string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(string(d), name+".mustache"))
+
+	return string(b), err
+}
+
+// FSLoader loads partials from files named name + ".mustache" within a file system,
+// which allows templates to be embedded in the binary with embed.FS.
+// Names that are not valid paths within the file system return ErrPartialOutsideRoot.
+// Symlinks are followed as the file system does, os.DirFS follows them out of its directory
+// whereas the FS method of an os.Root does not.
+type FSLoader struct {
+	FS fs.FS
+}
+
+// Load reads the partial from the file system.
+func (l FSLoader) Load(name string) (string, error) {
+	if !fs.ValidPath(name+".mustache") {
+		return "", &fs.PathError{Op: "load", Path: name, Err: ErrPartialOutsideRoot}
+	}
+
+	b, err := fs.ReadFile(l.FS, name+".mustache")
+
+	return string(b), err
+}
+
+// MapLoader loads partials held in memory, keyed by name.
+type MapLoader map[string]string
+
+// Load looks up the partial in the map.
+func (m MapLoader) Load(name string) (string, error) {
+	if s, ok := m[name]; ok {
+		return s, nil
+	}
+
+	return "", &fs.PathError{Op: "load", Path: name, Err: fs.ErrNotExist}
+}
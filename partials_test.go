@@ -0,0 +1,194 @@
+package mustache
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestPartialLoaders(t *testing.T) {
+	type expects struct {
+		desc   string
+		loader PartialLoader
+	}
+
+	e := [...]expects{
+		expects{"dir", DirLoader("test-assets")},
+		expects{"unsafe dir", UnsafeDirLoader("test-assets")},
+		expects{"fs", FSLoader{fstest.MapFS{"partial.mustache": &fstest.MapFile{Data: []byte("{{foo}}")}}}},
+		expects{"map", MapLoader{"partial": "{{foo}}"}},
+	}
+
+	for _, ex := range e {
+		template, err := Compile("{{name}}{{> partial }}", Partials(ex.loader))
+		if err != nil {
+			t.Errorf("Unexpected error compiling with the %s loader, %s", ex.desc, err)
+		}
+		if r := template.Render(map[string]string{"name": "stove", "foo": "bar"}); r != "stovebar" {
+			t.Errorf("Incorrect rendered template with the %s loader, got %s, expected %s", ex.desc, r, "stovebar")
+		}
+	}
+}
+
+func TestPartialLoadersMissing(t *testing.T) {
+	loaders := [...]PartialLoader{
+		DirLoader("test-assets"),
+		FSLoader{fstest.MapFS{}},
+		MapLoader{},
+	}
+
+	for _, loader := range loaders {
+		if _, err := loader.Load("missing"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Expected a not exist error from %T, got %v", loader, err)
+		}
+	}
+}
+
+func TestPartialLoadersOutsideRoot(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	os.MkdirAll(filepath.Join(root, "sub"), 0777)
+	os.WriteFile(filepath.Join(dir, "secret.mustache"), []byte("secret"), 0666)
+	os.WriteFile(filepath.Join(root, "sub", "inside.mustache"), []byte("inside"), 0666)
+	if err := os.Symlink(filepath.Join(dir, "secret.mustache"), filepath.Join(root, "link.mustache")); err != nil {
+		t.Skip("symlinks are not supported", err)
+	}
+
+	names := [...]string{"../secret", "sub/../../secret", filepath.Join(dir, "secret"), "link"}
+	loaders := [...]PartialLoader{DirLoader(root), FSLoader{os.DirFS(root)}}
+	for _, loader := range loaders {
+		for _, name := range names {
+			if name == "link" {
+				if _, ok := loader.(FSLoader); ok {
+					continue // os.DirFS follows symlinks
+				}
+			}
+			if _, err := loader.Load(name); !errors.Is(err, ErrPartialOutsideRoot) {
+				t.Errorf("Expected %T to refuse %s, got %v", loader, name, err)
+			}
+		}
+		if s, err := loader.Load("sub/inside"); err != nil || s != "inside" {
+			t.Errorf("Expected %T to load a partial in a subdirectory, got %q %v", loader, s, err)
+		}
+	}
+
+	if s, err := UnsafeDirLoader(root).Load("../secret"); err != nil || s != "secret" {
+		t.Errorf("Expected the unsafe loader to load a partial outside of the directory, got %q %v", s, err)
+	}
+
+	template, _ := Compile("a\n{{> ../secret}}", Name("page"), Partials(DirLoader(root)))
+	err := template.Execute(&bytes.Buffer{}, nil)
+	if !errors.Is(err, ErrPartialOutsideRoot) || err.Error() != "page:2:1: Render error: partial ../secret is not allowed for {{> ../secret}}: load ../secret: partial is outside of the root" {
+		t.Errorf("Expected an error for a partial outside of the directory, got %v", err)
+	}
+	var perr *ParseError
+	if errors.As(err, &perr) {
+		t.Errorf("Expected a partial outside of the directory not to be reported as a missing partial, got %v", err)
+	}
+}
+
+func TestStandalonePartialIndentation(t *testing.T) {
+	type expects struct {
+		template string
+		partials MapLoader
+		expected string
+	}
+
+	e := [...]expects{
+		expects{"\\\n {{>partial}}\n/\n", MapLoader{"partial": "|\n{{{content}}}\n|\n"}, "\\\n |\n <\n->\n |\n/\n"},
+		expects{"  {{>partial}}\n>", MapLoader{"partial": ">\n>"}, "  >\n  >>"},
+		expects{">\n  {{>partial}}", MapLoader{"partial": ">\n>"}, ">\n  >\n  >"},
+		expects{"a:\n  {{> b}}\n", MapLoader{"b": "b:\n  {{> c}}\n", "c": "c: {{content}}\n"}, "a:\n  b:\n    c: &lt;\n-&gt;\n"},
+		expects{"x {{>partial}}\n\t{{>partial}}\r\n", MapLoader{"partial": "1\n2\n"}, "x 1\n2\n\n\t1\n\t2\n"},
+		expects{"  {{>partial}}\n", MapLoader{"partial": "{{#list}}\n{{.}}\n{{/list}}\n"}, "  1\n  2\n"},
+	}
+
+	for _, ex := range e {
+		template, err := Compile(ex.template, Partials(ex.partials))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := map[string]interface{}{"content": "<\n->", "list": []int{1, 2}}
+		if r := template.Render(data); r != ex.expected {
+			t.Errorf("Incorrect rendered template for %q, got %q, expected %q", ex.template, r, ex.expected)
+		}
+	}
+}
+
+func TestDynamicPartial(t *testing.T) {
+	type expects struct {
+		template string
+		data     interface{}
+		expected string
+	}
+
+	partials := MapLoader{"content": "Hello, {{foo}}!", "test": "test", "foobar": "{{bar}}", "list": "- {{name}}\n"}
+
+	e := [...]expects{
+		expects{"{{>*dynamic}}", map[string]interface{}{"dynamic": "content", "foo": "world"}, "Hello, world!"},
+		expects{"{{>*a.b}}", map[string]interface{}{"a": map[string]string{"b": "test"}}, "test"},
+		expects{"[{{>*missing}}][{{>*a.missing}}][{{>*nil}}]", map[string]interface{}{"nil": nil}, "[][][]"},
+		expects{"{{#a}}{{>*b}}{{/a}}", map[string]interface{}{"a": map[string]string{"bar": "baz"}, "b": "foobar"}, "baz"},
+		expects{"|{{> * dynamic }}|", map[string]interface{}{"dynamic": "test"}, "|test|"},
+		expects{"{{>*dynamic}}", map[string]interface{}{"dynamic": "nope"}, ""},
+		expects{"items:\n  {{>*item}}\n", map[string]interface{}{"item": "list", "name": "x"}, "items:\n  - x\n"},
+	}
+
+	for _, ex := range e {
+		template, err := Compile(ex.template, Partials(partials))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r := template.Render(ex.data); r != ex.expected {
+			t.Errorf("Incorrect rendered template for %q, got %q, expected %q", ex.template, r, ex.expected)
+		}
+	}
+
+	template, _ := Compile("{{>*name}}", Name("page"), Partials(DirLoader("test-assets")), MissingKeys(ErrorOnMissingKeys))
+	if err := template.Execute(&bytes.Buffer{}, map[string]string{}); err == nil || err.Error() != "page:1:1: Render error: name was not found for {{>*name}}" {
+		t.Errorf("Expected an error for a missing partial name, got %v", err)
+	}
+	if err := template.Execute(&bytes.Buffer{}, map[string]string{"name": "../partial"}); !errors.Is(err, ErrPartialOutsideRoot) {
+		t.Errorf("Expected an error for a partial name outside of the directory, got %v", err)
+	}
+}
+
+func TestRecursivePartial(t *testing.T) {
+	loader := MapLoader{"node": "{{content}}<{{#nodes}}{{>node}}{{/nodes}}>"}
+	template, _ := Compile("{{>node}}", Partials(loader))
+
+	data := map[string]interface{}{
+		"content": "X",
+		"nodes": []interface{}{
+			map[string]interface{}{"content": "Y", "nodes": []interface{}{}},
+		},
+	}
+
+	if r := template.Render(data); r != "X<Y<>>" {
+		t.Errorf("Incorrect rendered template, got %s, expected %s", r, "X<Y<>>")
+	}
+}
+
+func TestRecursivePartialDepth(t *testing.T) {
+	template, _ := Compile("{{>loop}}", Partials(MapLoader{"loop": "x{{>loop}}"}))
+
+	var b bytes.Buffer
+	if err := template.Execute(&b, map[string]string{}); err == nil {
+		t.Errorf("Expected an error for a partial that never terminates")
+	}
+	if b.Len() != maxPartialDepth {
+		t.Errorf("Expected %d levels of output before stopping, got %d", maxPartialDepth, b.Len())
+	}
+}
+
+func TestMissingPartial(t *testing.T) {
+	template, _ := Compile("a{{>missing}}b", Partials(MapLoader{}))
+
+	if r := template.Render(map[string]string{}); r != "ab" {
+		t.Errorf("Incorrect rendered template, got %s, expected %s", r, "ab")
+	}
+}
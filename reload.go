@@ -0,0 +1,168 @@
+package mustache
+
+import (
+	"errors"
+	"io/fs"
+	"time"
+)
+
+// SetFile is the file a template in a set was parsed from.
+type setFile struct {
+	fsys    fs.FS
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+// SetRoot is a file system parsed by a set and the patterns used to find its templates.
+type setRoot struct {
+	fsys     fs.FS
+	patterns []string
+}
+
+// ReloadOnChange makes the set check the files of a template, and of the partials and parents it
+// includes, before each time the template is executed. The dynamic partials a template includes are
+// checked once it has included them while rendering. Files that have changed are parsed again,
+// files that have been removed remove their templates from the set and partials that are not in the set
+// are looked for in the file systems parsed. Errors parsing a changed file are returned by Execute,
+// and the file is parsed again the next time.
+//
+// It is meant for development, where templates are edited while they are being used. Without it
+// templates are only read when the set is parsed, and executing them does no extra work.
+// Only Execute, ExecuteContext and Render reload, templates returned by Lookup are not reloaded
+// and templates added with Add have no file to reload from.
+func (s *Set) ReloadOnChange() {
+	s.mu.Lock()
+	s.reload = true
+	s.mu.Unlock()
+}
+
+// Refresh reparses the files of the named template, and of the partials it includes, that have changed
+// when the set reloads on change.
+func (s *Set) refresh(name string) error {
+	s.mu.RLock()
+	reload := s.reload
+	s.mu.RUnlock()
+	if !reload {
+		return nil
+	}
+
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	scanned := false
+
+	return s.refreshTemplate(name, make(map[string]bool), &scanned)
+}
+
+// RefreshTemplate reparses the file of the named template if it has changed, then refreshes the
+// partials it includes. Templates that are not in the set are looked for once per refresh.
+func (s *Set) refreshTemplate(name string, seen map[string]bool, scanned *bool) error {
+	if seen[name] {
+		return nil
+	}
+	seen[name] = true
+
+	s.mu.RLock()
+	f, ok := s.files[name]
+	s.mu.RUnlock()
+
+	if ok {
+		info, err := fs.Stat(f.fsys, f.path)
+		if errors.Is(err, fs.ErrNotExist) {
+			s.remove(name)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !info.ModTime().Equal(f.modTime) || info.Size() != f.size {
+			f.modTime, f.size = info.ModTime(), info.Size()
+			if err := s.parseFile(name, f); err != nil {
+				return err
+			}
+		}
+	}
+
+	t := s.Lookup(name)
+	if t == nil && !*scanned {
+		*scanned = true
+		if err := s.scan(); err != nil {
+			return err
+		}
+		t = s.Lookup(name)
+	}
+	if t == nil {
+		return nil
+	}
+
+	for _, ref := range t.Partials() {
+		if err := s.refreshTemplate(ref.Name, seen, scanned); err != nil {
+			return err
+		}
+	}
+
+	s.mu.RLock()
+	dynamic := make([]string, 0, len(s.dynamic[name]))
+	for partial := range s.dynamic[name] {
+		dynamic = append(dynamic, partial)
+	}
+	s.mu.RUnlock()
+
+	for _, partial := range dynamic {
+		if err := s.refreshTemplate(partial, seen, scanned); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Loaded records that the named template included the dynamic partial while rendering, so that the
+// partial is checked along with the template. Nothing is recorded unless the set reloads on change.
+func (s *Set) loaded(name, partial string) {
+	s.mu.RLock()
+	recorded := !s.reload || s.dynamic[name][partial]
+	s.mu.RUnlock()
+	if recorded {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dynamic == nil {
+		s.dynamic = make(map[string]map[string]bool)
+	}
+	if s.dynamic[name] == nil {
+		s.dynamic[name] = make(map[string]bool)
+	}
+	s.dynamic[name][partial] = true
+}
+
+// Scan parses the files in the file systems of the set that are not yet in it.
+func (s *Set) scan() error {
+	s.mu.RLock()
+	roots := s.roots
+	s.mu.RUnlock()
+
+	for _, root := range roots {
+		if err := s.parseFS(root.fsys, root.patterns, true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Remove removes the named template from the set.
+func (s *Set) remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.templates, name)
+	delete(s.sources, name)
+	delete(s.files, name)
+	delete(s.dynamic, name)
+	s.removeIndented(name)
+}
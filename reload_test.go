@@ -0,0 +1,76 @@
+package mustache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSetReloadOnChange(t *testing.T) {
+	dir := t.TempDir()
+	modTime := time.Now()
+	write := func(name, content string) {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0777)
+		if err := os.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+		// the mod time moves forward with every write, in case the file system only records seconds
+		modTime = modTime.Add(time.Second)
+		os.Chtimes(path, modTime, modTime)
+	}
+	write("page.mustache", "{{> partials/header}}|{{name}}")
+	write("partials/header.mustache", "{{<layout}}{{$title}}header{{/title}}{{/layout}}")
+	write("layout.mustache", "<h1>{{$title}}{{/title}}</h1>")
+
+	set, err := ParseDir(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixed, _ := ParseDir(dir, nil)
+	set.ReloadOnChange()
+
+	type expects struct {
+		desc     string
+		change   func()
+		expected string
+		err      string
+	}
+
+	e := [...]expects{
+		expects{"unchanged", func() {}, "<h1>header</h1>|steve", ""},
+		expects{"a changed parent of a partial", func() { write("layout.mustache", "<h2>{{$title}}{{/title}}</h2>") }, "<h2>header</h2>|steve", ""},
+		expects{"a new partial", func() { write("page.mustache", "{{> partials/header}}|{{> partials/footer}}") }, "<h2>header</h2>|", ""},
+		expects{"a created partial", func() { write("partials/footer.mustache", "footer") }, "<h2>header</h2>|footer", ""},
+		expects{"a removed partial", func() { os.Remove(filepath.Join(dir, "partials/header.mustache")) }, "|footer", ""},
+		expects{"a malformed template", func() { write("partials/footer.mustache", "{{#footer}}") }, "", "partials/footer:1:1: Malformed template: footer was not closed"},
+		expects{"a fixed template", func() { write("partials/footer.mustache", "fixed") }, "|fixed", ""},
+		expects{"a dynamic partial", func() { write("page.mustache", "{{>*widget}}|{{name}}") }, "fixed|steve", ""},
+		expects{"a changed dynamic partial", func() { write("partials/footer.mustache", "changed") }, "changed|steve", ""},
+	}
+
+	for _, ex := range e {
+		ex.change()
+		r, err := set.Render("page", map[string]string{"name": "steve", "widget": "partials/footer"})
+		if ex.err != "" {
+			if err == nil || err.Error() != ex.err {
+				t.Errorf("Expected an error after %s, got %v", ex.desc, err)
+			}
+			continue
+		}
+		if err != nil || r != ex.expected {
+			t.Errorf("Incorrect rendered template after %s, got %q and %v, expected %q", ex.desc, r, err, ex.expected)
+		}
+	}
+
+	os.Remove(filepath.Join(dir, "page.mustache"))
+	if _, err := set.Render("page"); err == nil {
+		t.Errorf("Expected an error rendering a removed template")
+	}
+
+	// without reloading the templates are as they were parsed
+	if r, err := fixed.Render("page", map[string]string{"name": "steve"}); err != nil || r != "<h1>header</h1>|steve" {
+		t.Errorf("Expected a set that does not reload to be unchanged, got %q and %v", r, err)
+	}
+}
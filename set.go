@@ -0,0 +1,307 @@
+package mustache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// defaultPatterns are used to find templates when no patterns are given.
+var defaultPatterns = []string{"**/*.mustache"}
+
+// Set is a collection of templates, named by their path relative to the directory
+// they were loaded from without an extension. Templates in a set can use each other as partials.
+// A set is safe for concurrent use.
+type Set struct {
+	mu        sync.RWMutex
+	templates map[string]*Template
+	sources   map[string]string
+	opts      []Option
+	indented  map[partialKey]*token // templates compiled as indented standalone partials
+
+	reload   bool                       // whether templates are reparsed when their files change, see ReloadOnChange
+	reloadMu sync.Mutex                 // held while reloading, so that files are only reparsed once
+	files    map[string]setFile         // the files templates were parsed from, by name
+	roots    []setRoot                  // the file systems parsed, to find templates created while reloading
+	dynamic  map[string]map[string]bool // the dynamic partials each template has included while rendering
+}
+
+// NewSet returns an empty set. The options are applied to every template in the set.
+func NewSet(opts ...Option) *Set {
+	return &Set{
+		templates: make(map[string]*Template),
+		sources:   make(map[string]string),
+		files:     make(map[string]setFile),
+		opts:      opts,
+	}
+}
+
+// ParseFS returns a new set holding the templates in fsys that match any of the patterns,
+// or **/*.mustache if there are none. The options are applied to every template in the set.
+func ParseFS(fsys fs.FS, patterns []string, opts ...Option) (*Set, error) {
+	s := NewSet(opts...)
+
+	return s, s.ParseFS(fsys, patterns...)
+}
+
+// ParseDir returns a new set holding the templates in dir that match any of the patterns,
+// or **/*.mustache if there are none. The options are applied to every template in the set.
+func ParseDir(dir string, patterns []string, opts ...Option) (*Set, error) {
+	s := NewSet(opts...)
+
+	return s, s.ParseDir(dir, patterns...)
+}
+
+// ParseDir compiles the templates in dir that match any of the patterns and adds them to the set.
+func (s *Set) ParseDir(dir string, patterns ...string) error {
+	return s.ParseFS(os.DirFS(dir), patterns...)
+}
+
+// ParseFS compiles the files in fsys that match any of the patterns and adds them to the set.
+// Patterns use the syntax of path.Match, with the addition that a ** segment matches any number
+// of directories. If no patterns are given then **/*.mustache is used.
+// A file that can not be parsed does not stop the others from being added, the errors
+// of all of them are returned joined by errors.Join.
+func (s *Set) ParseFS(fsys fs.FS, patterns ...string) error {
+	if len(patterns) == 0 {
+		patterns = defaultPatterns
+	}
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	s.roots = append(s.roots, setRoot{fsys, patterns})
+	s.mu.Unlock()
+
+	return s.parseFS(fsys, patterns, false)
+}
+
+// ParseFS compiles the files in fsys that match any of the patterns and adds them to the set,
+// skipping those whose names are already in the set if onlyNew is true.
+func (s *Set) parseFS(fsys fs.FS, patterns []string, onlyNew bool) error {
+	var errs []error
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !matchesAny(patterns, p) {
+			return err
+		}
+
+		name := strings.TrimSuffix(p, path.Ext(p))
+		if onlyNew && s.Lookup(name) != nil {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err == nil {
+			err = s.parseFile(name, setFile{fsys: fsys, path: p, modTime: info.ModTime(), size: info.Size()})
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		return nil
+	})
+
+	return errors.Join(append(errs, err)...)
+}
+
+// ParseFile reads a template from its file and adds it to the set, recording the file it was read from.
+func (s *Set) parseFile(name string, f setFile) error {
+	b, err := fs.ReadFile(f.fsys, f.path)
+	if err != nil {
+		return err
+	}
+	if err := s.Add(name, string(b)); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.files[name] = f
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Add compiles a template and adds it to the set with the given name, replacing any template of the same name.
+func (s *Set) Add(name, template string) error {
+	opts := append([]Option{Partials(s), Name(name)}, s.opts...)
+	t, err := Compile(template, opts...)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.templates[name] = t
+	s.sources[name] = template
+	delete(s.files, name)
+	s.removeIndented(name)
+	s.mu.Unlock()
+
+	return nil
+}
+
+// RemoveIndented removes the indented versions of the named template, which must be done with the lock held.
+func (s *Set) removeIndented(name string) {
+	for key := range s.indented {
+		if key.name == name {
+			delete(s.indented, key)
+		}
+	}
+}
+
+// Lookup returns the named template, or nil if it is not in the set.
+func (s *Set) Lookup(name string) *Template {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.templates[name]
+}
+
+// Partial returns the compiled template for use as a partial included with the given indentation,
+// compiling the indented source on first use. A nil token is returned if the template is not in the set.
+// Only inserting a newly indented template takes the write lock, so that renders do not wait on each other.
+func (s *Set) partial(name, indent string) (*token, error) {
+	key := partialKey{name, indent}
+
+	s.mu.RLock()
+	t := s.templates[name]
+	src := s.sources[name]
+	p, ok := s.indented[key]
+	s.mu.RUnlock()
+
+	if t == nil {
+		return nil, nil
+	}
+	if indent == "" {
+		return t.token, nil
+	}
+	if ok {
+		return p, nil
+	}
+
+	p, err := t.compile(name, indentLines(src, indent), defaultOtag, defaultCtag)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// the template may have been replaced while compiling, in which case its indented version is not kept
+	if s.templates[name] != t {
+		return p, nil
+	}
+	if existing, ok := s.indented[key]; ok {
+		return existing, nil
+	}
+	if s.indented == nil {
+		s.indented = make(map[partialKey]*token)
+	}
+	s.indented[key] = p
+
+	return p, nil
+}
+
+// Names returns the names of the templates in the set.
+func (s *Set) Names() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := make([]string, 0, len(s.templates))
+	for name := range s.templates {
+		names = append(names, name)
+	}
+
+	return names
+}
+
+// Load returns the source of the named template so that the set can be used as a PartialLoader.
+func (s *Set) Load(name string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if src, ok := s.sources[name]; ok {
+		return src, nil
+	}
+
+	return "", &fs.PathError{Op: "load", Path: name, Err: fs.ErrNotExist}
+}
+
+// Execute renders the named template using the provided data and writes the output to w.
+func (s *Set) Execute(w io.Writer, name string, data ...interface{}) error {
+	if err := s.refresh(name); err != nil {
+		return err
+	}
+
+	t := s.Lookup(name)
+	if t == nil {
+		return &fs.PathError{Op: "execute", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return t.Execute(w, data...)
+}
+
+// ExecuteContext is like Execute, but stops rendering with the error of the context once it is done.
+func (s *Set) ExecuteContext(ctx context.Context, w io.Writer, name string, data ...interface{}) error {
+	if err := s.refresh(name); err != nil {
+		return err
+	}
+
+	t := s.Lookup(name)
+	if t == nil {
+		return &fs.PathError{Op: "execute", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return t.ExecuteContext(ctx, w, data...)
+}
+
+// Render renders the named template using the provided data.
+func (s *Set) Render(name string, data ...interface{}) (string, error) {
+	var b bytes.Buffer
+	err := s.Execute(&b, name, data...)
+
+	return b.String(), err
+}
+
+// MatchesAny returns a boolean indicating if the slash separated path matches any of the patterns.
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MatchSegments matches the segments of a path against the segments of a pattern,
+// where a ** segment matches zero or more segments of the path.
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return len(name) == 0
+}
@@ -0,0 +1,153 @@
+package mustache
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestSet(t *testing.T) {
+	fsys := fstest.MapFS{
+		"layout.mustache":        &fstest.MapFile{Data: []byte("<h1>{{$title}}{{/title}}</h1>{{> partials/footer}}")},
+		"pages/home.mustache":    &fstest.MapFile{Data: []byte("{{<layout}}{{$title}}Home {{name}}{{/title}}{{/layout}}")},
+		"partials/footer.html":   &fstest.MapFile{Data: []byte("<footer>{{name}}</footer>")},
+		"partials/ignored.txt":   &fstest.MapFile{Data: []byte("ignored")},
+		"deep/a/b/c.mustache":    &fstest.MapFile{Data: []byte("c")},
+		"partials/footer.backup": &fstest.MapFile{Data: []byte("{{#broken}}")},
+	}
+
+	set, err := ParseFS(fsys, []string{"**/*.mustache", "partials/*.html"})
+	if err != nil {
+		t.Fatalf("Unexpected error while parsing, %s", err)
+	}
+
+	if r, err := set.Render("pages/home", map[string]string{"name": "steve"}); err != nil || r != "<h1>Home steve</h1><footer>steve</footer>" {
+		t.Errorf("Incorrect rendered template, got %s and %v", r, err)
+	}
+	if len(set.Names()) != 4 || set.Lookup("deep/a/b/c") == nil || set.Lookup("partials/ignored") != nil {
+		t.Errorf("Incorrect templates in the set, got %v", set.Names())
+	}
+	if _, err := set.Render("missing"); err == nil {
+		t.Errorf("Expected an error rendering a template that is not in the set")
+	}
+
+	// replacing a partial is seen by the templates using it
+	set.Add("partials/footer", "<p>{{name}}</p>")
+	if r, _ := set.Render("pages/home", map[string]string{"name": "steve"}); r != "<h1>Home steve</h1><p>steve</p>" {
+		t.Errorf("Incorrect rendered template after replacing a partial, got %s", r)
+	}
+
+	// the files that can be parsed are added, along with the errors of the others
+	fsys["partials/other.backup"] = &fstest.MapFile{Data: []byte("{{/other}}")}
+	partials, err := ParseFS(fsys, []string{"partials/*"})
+	var perr *ParseError
+	if !errors.As(err, &perr) || len(err.(interface{ Unwrap() []error }).Unwrap()) != 2 {
+		t.Errorf("Expected the errors of both malformed templates, got %v", err)
+	}
+	if partials.Lookup("partials/footer") == nil || partials.Lookup("partials/ignored") == nil {
+		t.Errorf("Expected the templates that could be parsed, got %v", partials.Names())
+	}
+	if _, err := ParseFS(fsys, []string{"[*.mustache"}); err == nil {
+		t.Errorf("Expected an error for a malformed pattern")
+	}
+}
+
+func TestSetIndentedPartial(t *testing.T) {
+	set := NewSet()
+	set.Add("list", "items:\n  {{> item}}\n")
+	set.Add("item", "- a\n- b\n")
+
+	if r, err := set.Render("list"); err != nil || r != "items:\n  - a\n  - b\n" {
+		t.Errorf("Incorrect rendered template, got %q and %v", r, err)
+	}
+
+	// replacing a partial replaces its indented versions
+	set.Add("item", "- c\n")
+	if r, err := set.Render("list"); err != nil || r != "items:\n  - c\n" {
+		t.Errorf("Incorrect rendered template after replacing a partial, got %q and %v", r, err)
+	}
+}
+
+func TestSetDir(t *testing.T) {
+	set, err := ParseDir("test-assets", nil, Escape(EscapeNone))
+	if err != nil {
+		t.Fatalf("Unexpected error while parsing, %s", err)
+	}
+	if r, _ := set.Render("partial", map[string]string{"foo": "<bar>"}); r != "<bar>" {
+		t.Errorf("Incorrect rendered template, got %s", r)
+	}
+}
+
+func TestSetConcurrentRender(t *testing.T) {
+	set := NewSet(Escape(EscapeNone))
+	set.Add("item", "{{.}}&")
+	set.Add("list", "{{#items}}{{> item}}{{/items}}")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			expected := fmt.Sprintf("%d&%d&", i, i+1)
+			if r, err := set.Render("list", map[string]interface{}{"items": []int{i, i + 1}}); r != expected || err != nil {
+				t.Errorf("Incorrect rendered template, got %s and %v, expected %s", r, err, expected)
+			}
+			set.Add(fmt.Sprintf("extra%d", i), "{{x}}")
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestSetRenderReadLocked(t *testing.T) {
+	set := NewSet()
+	set.Add("item", "- {{.}}\n")
+	set.Add("list", "{{#items}}{{> item}}{{/items}}items:\n  {{#items}}\n  {{> item}}\n  {{/items}}\n")
+	set.Render("list", map[string]interface{}{"items": []int{1}})
+
+	// rendering partials that are already compiled only needs the read lock, so it is not blocked by other readers
+	set.mu.RLock()
+	defer set.mu.RUnlock()
+
+	done := make(chan string, 1)
+	go func() {
+		r, _ := set.Render("list", map[string]interface{}{"items": []int{1}})
+		done <- r
+	}()
+
+	select {
+	case r := <-done:
+		if r != "- 1\nitems:\n  - 1\n" {
+			t.Errorf("Incorrect rendered template, got %q", r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected rendering to only take the read lock of the set")
+	}
+}
+
+func TestMatchesAny(t *testing.T) {
+	type expects struct {
+		pattern string
+		name    string
+		matches bool
+	}
+
+	e := [...]expects{
+		expects{"*.mustache", "a.mustache", true},
+		expects{"*.mustache", "a/b.mustache", false},
+		expects{"**/*.mustache", "a.mustache", true},
+		expects{"**/*.mustache", "a/b/c.mustache", true},
+		expects{"a/**", "a/b/c", true},
+		expects{"a/**/c", "a/c", true},
+		expects{"a/**/c", "a/b/d", false},
+		expects{"**/*.html", "a/b.mustache", false},
+	}
+
+	for _, ex := range e {
+		if matchesAny([]string{ex.pattern}, ex.name) != ex.matches {
+			t.Errorf("Incorrect match of %s against %s, expected %t", ex.name, ex.pattern, ex.matches)
+		}
+	}
+}